@@ -4,270 +4,570 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math"
-	"net/http"
-	"sort"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-jsonrpc"
 	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/lotus/api/client"
-	"github.com/filecoin-project/lotus/api/v1api"
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/types"
-	"github.com/shopspring/decimal"
-
+	"github.com/ipfs/go-cid"
+
+	"check-sector-info/config"
+	"check-sector-info/dealcache"
+	"check-sector-info/extension"
+	"check-sector-info/lotusclient"
+	"check-sector-info/output"
+	"check-sector-info/sectorreport"
+	"check-sector-info/sectorstatus"
 	"check-sector-info/sqlexec"
+	"check-sector-info/termination"
 	timeToHeight "check-sector-info/time-height"
 )
 
-func ConnectClient(apiUrl string) (v1api.FullNode, jsonrpc.ClientCloser, error) {
-	header := http.Header{}
+func ConnectClient(apiUrl string) (lotusclient.Node, jsonrpc.ClientCloser, error) {
+	if *replayDir != "" && *recordDir != "" {
+		return nil, nil, fmt.Errorf("-record and -replay cannot be used together")
+	}
+	if *replayDir != "" {
+		f, err := lotusclient.NewReplayer(*replayDir)
+		return f, func() {}, err
+	}
+
 	ctx := context.Background()
-	return client.NewFullNodeRPCV1(ctx, apiUrl, header)
+	retry := lotusclient.DefaultRetry
+	retry.CallTimeout = *callTimeout
+	retry.Attempts = *attempts
+	c, closer, err := lotusclient.Connect(ctx, lotusclient.Options{URL: apiUrl, Token: *token, Headers: headers}, retry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *rpcLog {
+		c.Logf = log.Printf
+	}
+
+	if *recordDir != "" {
+		f, err := lotusclient.NewRecorder(*recordDir, c)
+		if err != nil {
+			closer()
+			return nil, nil, err
+		}
+		return f, closer, nil
+	}
+	return c, closer, nil
 }
 
-var url = flag.String("l", "http://127.0.0.1:1234/rpc/v0", "lotusAPI")
+var configPath = flag.String("config", "", "config file, defaults to $CSI_CONFIG or the first of "+strings.Join(config.SearchPaths(), ", ")+" that exists")
+var url = flag.String("l", "", "lotusAPI, several separated by commas to fail over between, defaults to the addresses in FULLNODE_API_INFO or "+lotusclient.DefaultURL)
+var token = flag.String("token", "", "lotus API token, defaults to $TOKEN or the token in FULLNODE_API_INFO")
+var headers lotusclient.Headers
+var callTimeout = flag.Duration("timeout", lotusclient.DefaultRetry.CallTimeout, "timeout of each lotus API call attempt")
+var attempts = flag.Int("attempts", lotusclient.DefaultRetry.Attempts, "tries per lotus API call, failing over to the next -l endpoint after each failure")
+var deadline = flag.Duration("deadline", 0, "give up on the whole run after this long, 0 for no limit")
+var recordDir = flag.String("record", "", "save every lotus API response of this run to the directory")
+var replayDir = flag.String("replay", "", "answer lotus API calls from a -record directory instead of a node")
+var rpcLog = flag.Bool("rpc-log", false, "log which lotus endpoint served each call")
 var detail = flag.Bool("v", false, "print sector detail")
-var minerStr = flag.String("m", "", "miner")
-var clusterName = flag.String("c", "", "cluster name,example:xc64,hk01")
-var date = flag.String("d", "", "dateTime, example:2023-11-01 00:00:00")
-
-type SectorInfoByDate struct {
-	Date     string
-	DcCount  int
-	CcCount  int
-	OdCount  int
-	DCPledge float64
-	CcPledge float64
-	OdPledge float64
+var minerList, clusterList listFlag
+var allClusters = flag.Bool("all", false, "query every cluster in the ops db")
+var jobs = flag.Int("j", 4, "number of miners queried concurrently")
+var date = flag.String("d", "", "dateTime or tipset key, example:2023-11-01 00:00:00")
+var from = flag.String("from", "", "diff start point, dateTime or tipset key like -d, the end point is -d or the chain head")
+var format = flag.String("f", "text", "output format: text, json, csv, ndjson")
+var workers = flag.Int("w", 16, "number of concurrent deal lookups")
+var mode = flag.String("mode", "report", "report: expiration report, deadlines: breakdown by deadline and partition, plan-extend: write ExtendSectorExpiration2 params without sending them, diff: changes between -from and -d")
+var extendTo = flag.String("to", "", "plan-extend target expiration, dateTime like -d or +N days from the queried tipset, example:+540")
+var planDir = flag.String("plan-dir", "extend-plan", "directory plan-extend writes the params to")
+var withStatus = flag.Bool("status", false, "include faulty, recovering and terminated sectors and report them separately")
+var groupBy = flag.String("group", "expiration:day", "report rows grouped by a comma separated list of expiration[:day|week|month|quarter], activation[:granularity], proof, class")
+var network = flag.String("network", "", "mainnet, calibnet or devnet:<genesis unix>[:<block delay>], detected from the node when empty")
+var tz = flag.String("tz", "", "time zone for -d, -to and printed dates, example:Asia/Shanghai, defaults to the machine's zone")
+var exact = flag.Bool("exact", false, "resolve -d by searching tipset timestamps on chain instead of assuming 30s epochs, null rounds map to the tipset before them")
+var bulkDeals = flag.Bool("bulk-deals", false, "load all market deals once with StateMarketDeals instead of one call per deal")
+var sectorDeals = flag.Bool("sector-deals", true, "restore the deal ids of each miner's sectors from the market actor state, needed to tell dc from ddo sectors, requires nv22 or later")
+
+func init() {
+	flag.Var(&headers, "H", "extra http header sent to lotus, \"Key: Value\", can be repeated")
+	flag.Var(&minerList, "m", "miner, several separated by commas, can be repeated")
+	flag.Var(&clusterList, "c", "cluster name, several separated by commas, can be repeated,example:xc64,hk01")
 }
 
-func (s SortByDate) Len() int      { return len(s) }
-func (s SortByDate) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
-func (s SortByDate) Less(i, j int) bool {
-	return s[i].Date < s[j].Date
+// loadConfig fills the flags not given on the command line from the config
+// file and returns it.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	count := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	err = config.SetFlags(flag.CommandLine, map[string]string{
+		"l":       cfg.Lotus.URL,
+		"token":   cfg.Lotus.Token,
+		"network": cfg.Network,
+		"tz":      cfg.TZ,
+		"f":       cfg.Output.Format,
+		"group":   cfg.Output.Group,
+		"w":       count(cfg.Output.Workers),
+		"j":       count(cfg.Output.Jobs),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		for _, h := range cfg.Lotus.Headers {
+			if err := headers.Set(h); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cfg, nil
 }
 
-type SortByDate []SectorInfoByDate
-
 func main() {
 	flag.Parse()
 
-	if (*minerStr != "" && *clusterName != "") || (*minerStr == "" && *clusterName == "") {
-		fmt.Println("Error: Please provide either Miner or Cluster, but not both or neither.")
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	if len(minerList) == 0 && len(clusterList) == 0 && !*allClusters {
+		fmt.Println("Error: Please provide Miner, Cluster or -all.")
+		return
+	}
+
+	if *mode != "report" && *mode != "deadlines" && *mode != "plan-extend" && *mode != "diff" {
+		fmt.Println("Error: unknown mode", *mode)
+		return
+	}
+
+	if *mode == "plan-extend" && *extendTo == "" {
+		fmt.Println("Error: plan-extend requires -to")
+		return
+	}
+
+	if *mode == "diff" && *from == "" {
+		fmt.Println("Error: diff requires -from")
+		return
+	}
+
+	if *jobs < 1 {
+		fmt.Println("Error: -j must be at least 1")
+		return
+	}
+
+	outFormat, err := output.ParseFormat(*format)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	dims, err := sectorreport.ParseDimensions(*groupBy)
+	if err != nil {
+		fmt.Println("Error:", err)
 		return
 	}
+	thresholds := sectorreport.Thresholds{
+		MinDealWeight: cfg.Classify.MinDealWeight,
+		MixedDCShare:  cfg.Classify.MixedDCShare,
+		DealIDsKnown:  *bulkDeals || *sectorDeals,
+	}
+
+	// keep stdout clean for machine-readable formats
+	notice := os.Stdout
+	if outFormat != output.Text {
+		notice = os.Stderr
+	}
 
 	ctx := context.Background()
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
 
 	delegate, closer, err := ConnectClient(*url)
 	if err != nil {
-		log.Fatalf("connect to lotus api failed")
+		log.Fatalf("connect to lotus api: %v", err)
 	}
 	defer closer()
+
+	if _, err := timeToHeight.Configure(ctx, delegate, *network, *tz); err != nil {
+		log.Fatalf("set up epoch time conversion failed,err:%s", err)
+	}
+
 	var tsk types.TipSetKey
+	var at *timeToHeight.Resolution
 
 	if *date != "" {
-		dateTime, err := timeToHeight.StrToTime(*date)
+		at, err = resolvePoint(ctx, delegate, *date)
 		if err != nil {
-			fmt.Println("Error: Wrong datetime format")
+			fmt.Println("Error:", err)
 			return
 		}
+		fmt.Fprintf(notice, "查询时间 %s 使用 %s\n", *date, at)
+		tsk = at.Tipset
+	} else {
+		tsk = types.EmptyTSK
+	}
 
-		tsByHeight, err := delegate.ChainGetTipSetByHeight(ctx, timeToHeight.TimeToHeight(dateTime), types.EmptyTSK)
-		if err != nil {
-			fmt.Println("Error: Failed to obtain tsk of specified height:", err)
-			return
+	targets := resolveTargets(ctx, notice, cfg.DB.DSN)
+	if len(targets) == 0 {
+		fmt.Println("Error: no miner found")
+		return
+	}
+	if len(targets) > 1 && *mode != "report" {
+		fmt.Printf("Error: mode %s supports only one miner or cluster\n", *mode)
+		return
+	}
+
+	if *mode == "diff" {
+		runDiff(ctx, delegate, targets[0], at, outFormat, notice)
+		return
+	}
+
+	// one cache serves all miners, market deals are not per miner
+	deals := dealcache.New(delegate, tsk)
+	if *bulkDeals {
+		if err := deals.LoadAll(ctx); err != nil {
+			log.Fatalf("failed to load market deals,err:%s", err)
 		}
+	}
 
-		tsk = tsByHeight.Key()
+	if len(targets) > 1 {
+		runFleet(ctx, delegate, targets, tsk, at, dims, thresholds, deals, outFormat)
+		return
+	}
 
-	} else {
-		tsk = types.EmptyTSK
+	t := targets[0]
+	ms, err := loadMiner(ctx, delegate, t.addr, tsk, *withStatus || *mode == "deadlines", deals)
+	if err != nil {
+		log.Fatalf("failed to get miner sectors,err:%s", err)
 	}
 
-	var addr address.Address
-	if *minerStr != "" {
-		fmt.Println("检测到你本次使用的是矿工号，推荐使用集群代号查询，可通过-h 查询使用帮助")
-		addr, err = address.NewFromString(*minerStr)
-		if err != nil {
-			log.Fatalf("convert miner to addr failed,err:%s", err)
-		}
+	if *mode == "plan-extend" {
+		planExtend(ctx, delegate, t.addr, tsk, ms.live, deals, outFormat)
+		return
 	}
 
-	if *minerStr == "" {
-		dsn, err := sqlexec.ReadDSN()
+	if *mode == "deadlines" {
+		pol, err := extension.LoadPolicy(ctx, delegate, tsk)
 		if err != nil {
-			log.Fatalln(err)
+			log.Fatalf("failed to load network policy,err:%s", err)
 		}
-
-		db, err := sqlexec.InitDB(dsn)
-		if err != nil {
-			log.Fatalf("connect to ops db failed,err:%s", err)
+		rows := sectorreport.GroupByDeadline(ms.live, ms.statuses.PartitionCounts, ms.statuses.Location, sectorreport.Options{
+			TerminationFee: terminationFee(pol),
+			Status:         ms.statusOf,
+			Thresholds:     thresholds,
+		})
+		var perDeadline []sectorreport.SectorInfoByDate
+		for _, dl := range rows {
+			perDeadline = append(perDeadline, dl.SectorInfoByDate)
 		}
-
-		m, err := sqlexec.GetMiner(db, *clusterName)
-		if err != nil {
-			log.Fatalf("Failed to query miner, please confirm whether the cluster is correct")
+		r := DeadlineReport{
+			Cluster:   t.Cluster,
+			Miner:     t.addr.String(),
+			At:        at,
+			Deadlines: rows,
+			Total:     sectorreport.Sum(perDeadline),
 		}
-		addr, err = address.NewFromString(m)
-		if err != nil {
-			log.Fatalf("convert miner to addr failed,err:%s", err)
+		if err := r.Write(os.Stdout, outFormat); err != nil {
+			log.Fatalf("write report failed,err:%s", err)
 		}
-		fmt.Printf("cluster: %s,miner: %s,正在查询中，请稍等...\n", *clusterName, m)
+		return
 	}
 
-	sectorInfoList, err := delegate.StateMinerActiveSectors(ctx, addr, tsk)
+	r, err := buildReport(ctx, delegate, t, ms, tsk, at, dims, thresholds, deals)
 	if err != nil {
-		log.Fatalf("failed to get miner active sector,err:%s", err)
+		log.Fatalf("build report failed,err:%s", err)
 	}
+	if err := r.Write(os.Stdout, outFormat); err != nil {
+		log.Fatalf("write report failed,err:%s", err)
+	}
+}
 
-	//sort.Sort(sortByEpoch(sectorInfoList))
-	groups := make(map[string][]miner.SectorOnChainInfo)
-	for _, sector := range sectorInfoList {
-
-		var SectorType string
-		var Expandable bool
+type target struct {
+	Cluster string
+	addr    address.Address
+}
 
-		if fmt.Sprintf("%v", sector.DealWeight) == "0" && fmt.Sprintf("%v", sector.VerifiedDealWeight) == "0" {
-			SectorType = "cc"
+// resolveTargets collects the miners named by -m, -c and -all, in that
+// order and without duplicates. Clusters are looked up in the ops db at dsn.
+func resolveTargets(ctx context.Context, notice io.Writer, dsn string) []target {
+	var targets []target
+	seen := make(map[address.Address]bool)
+	add := func(cluster, m string) {
+		addr, err := address.NewFromString(m)
+		if err != nil {
+			log.Fatalf("convert miner to addr failed,err:%s", err)
+		}
+		if seen[addr] {
+			return
 		}
+		seen[addr] = true
+		targets = append(targets, target{Cluster: cluster, addr: addr})
+		if cluster != "" {
+			fmt.Fprintf(notice, "cluster: %s,miner: %s,正在查询中，请稍等...\n", cluster, m)
+		}
+	}
 
-		if fmt.Sprintf("%v", sector.DealWeight) == "0" && fmt.Sprintf("%v", sector.VerifiedDealWeight) != "0" {
-			SectorType = "dc"
+	if len(minerList) != 0 {
+		fmt.Fprintln(notice, "检测到你本次使用的是矿工号，推荐使用集群代号查询，可通过-h 查询使用帮助")
+		for _, m := range minerList {
+			add("", m)
 		}
+	}
 
-		if fmt.Sprintf("%v", sector.DealWeight) != "0" && fmt.Sprintf("%v", sector.VerifiedDealWeight) == "0" {
-			SectorType = "od"
+	if len(clusterList) != 0 || *allClusters {
+		if dsn == "" {
+			// the dsn file in the working directory predates the config file
+			var err error
+			dsn, err = sqlexec.ReadDSN()
+			if err != nil {
+				log.Fatalf("no ops db dsn, set db.dsn in the config file or CSI_DSN,err:%s", err)
+			}
 		}
 
-		var dealStartEpochs []int
+		repo, err := sqlexec.Open(ctx, dsn)
+		if err != nil {
+			log.Fatalf("connect to ops db failed,err:%s", err)
+		}
+		defer repo.Close()
 
-		if len(sector.DeprecatedDealIDs) != 0 {
-			for _, dealID := range sector.DeprecatedDealIDs {
-				dealInfo, err := delegate.StateMarketStorageDeal(ctx, dealID, types.EmptyTSK)
-				if err != nil {
-					log.Printf("failed to get deal info, err: %s\n", err)
-					continue
-				}
-				dealStartEpochs = append(dealStartEpochs, int(dealInfo.Proposal.StartEpoch))
+		for _, name := range clusterList {
+			m, err := repo.Miner(ctx, name)
+			if err != nil {
+				log.Fatalf("Failed to query miner of cluster %q, please confirm whether the cluster is correct,err:%s", name, err)
 			}
+			add(name, m)
+		}
 
-			allGreaterThanThreshold := true
-			for _, epoch := range dealStartEpochs {
-				if epoch <= 2383680 {
-					allGreaterThanThreshold = false
-					break
-				}
+		if *allClusters {
+			clusters, err := repo.Clusters(ctx)
+			if err != nil {
+				log.Fatalf("get cluster info failed,err:%s", err)
+			}
+			for _, c := range clusters {
+				add(c.Name, c.Miner)
 			}
-
-			Expandable = allGreaterThanThreshold
 		}
+	}
+	return targets
+}
+
+// listFlag collects a flag given several times, each value a comma
+// separated list.
+type listFlag []string
 
-		if *detail == true {
-			fmt.Printf("type:%s,sector:%d,Activation:%s,date:%s,expandable:%v,Expiration:%d,date:%s,DealWeight:%s,VerifiedDealWeight:%s,InitialPledge:%s,dealid:%v,DealStartEpoch:%d\n",
-				SectorType,
-				sector.SectorNumber,
-				sector.Activation,
-				timeToHeight.HeightToTime(sector.Activation),
-				Expandable,
-				sector.Expiration,
-				timeToHeight.HeightToTime(sector.Expiration),
-				sector.DealWeight,
-				sector.VerifiedDealWeight,
-				divideBy10ToThe18thDecimal(sector.InitialPledge),
-				sector.DeprecatedDealIDs,
-				dealStartEpochs)
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, splitList(v)...)
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
 		}
-		groups[timeToHeight.HeightToDay(sector.Expiration)] = append(groups[timeToHeight.HeightToDay(sector.Expiration)], *sector)
 	}
+	return list
+}
 
-	var cc, dc, od int
-	var ccp, dcp, odp float64
-	var sectorInfoByDate []SectorInfoByDate
-	for day, group := range groups {
+type minerSectors struct {
+	// all includes terminated sectors still listed in partitions, live
+	// only the ones holding pledge
+	all, live []*miner.SectorOnChainInfo
+	statuses  *sectorstatus.Sectors
+}
 
-		var DCCount, CCCount, ODCount int
-		var DCPledge, CCPledge, ODPledge float64
+func (m *minerSectors) statusOf(n abi.SectorNumber) sectorreport.Status {
+	if m.statuses == nil {
+		return sectorreport.Active
+	}
+	return m.statuses.Status(n)
+}
 
-		for _, s := range group {
-			str := fmt.Sprintf("%s", s.InitialPledge)
-			a, err := strconv.ParseFloat(str, 64)
-			f := a / math.Pow(10, 18)
-			if err != nil {
-				fmt.Println(err)
-			}
+// loadMiner reads the sectors of addr, from the partitions when
+// withPartitions is set so that their status is known, and prepares deals
+// for them.
+func loadMiner(ctx context.Context, delegate lotusclient.Node, addr address.Address, tsk types.TipSetKey,
+	withPartitions bool, deals *dealcache.Cache) (*minerSectors, error) {
+	ms := &minerSectors{}
+	if withPartitions {
+		statuses, err := sectorstatus.Load(ctx, delegate, addr, tsk)
+		if err != nil {
+			return nil, err
+		}
+		ms.statuses = statuses
+		ms.all = statuses.Infos
+		ms.live = statuses.Live()
+	} else {
+		sectors, err := delegate.StateMinerActiveSectors(ctx, addr, tsk)
+		if err != nil {
+			return nil, fmt.Errorf("get active sectors: %w", err)
+		}
+		ms.all = sectors
+		ms.live = sectors
+	}
 
-			if fmt.Sprintf("%v", s.DealWeight) == "0" && fmt.Sprintf("%v", s.VerifiedDealWeight) == "0" {
-				CCCount += 1
-				CCPledge += f
-			}
+	if !*bulkDeals && !*sectorDeals {
+		return ms, nil
+	}
+	if !*bulkDeals {
+		if err := deals.LoadSectors(ctx, addr); err != nil {
+			return nil, fmt.Errorf("restore sector deal ids, -sector-deals=false skips it: %w", err)
+		}
+	}
+	// the json api drops DeprecatedDealIDs, restore them from the market
+	// state so that dc and ddo sectors can be told apart
+	var dealIDs []abi.DealID
+	for _, sector := range ms.all {
+		if len(sector.DeprecatedDealIDs) == 0 {
+			sector.DeprecatedDealIDs = deals.SectorDeals(addr, sector.SectorNumber)
+		}
+		dealIDs = append(dealIDs, sector.DeprecatedDealIDs...)
+	}
+	// only -v and plan-extend read the deals themselves
+	if !*bulkDeals && (*detail || *mode == "plan-extend") {
+		deals.Prefetch(ctx, dealIDs, *workers)
+	}
+	return ms, nil
+}
 
-			if fmt.Sprintf("%v", s.DealWeight) == "0" && fmt.Sprintf("%v", s.VerifiedDealWeight) != "0" {
-				DCCount += 1
-				DCPledge += f
-			}
+func terminationFee(pol extension.Policy) sectorreport.FeeFunc {
+	return func(s *miner.SectorOnChainInfo) abi.TokenAmount {
+		return termination.Estimate(s, pol.NetworkVersion, pol.Epoch)
+	}
+}
 
-			if fmt.Sprintf("%v", s.DealWeight) != "0" && fmt.Sprintf("%v", s.VerifiedDealWeight) == "0" {
-				ODCount += 1
-				ODPledge += f
-			}
+func buildReport(ctx context.Context, delegate lotusclient.Node, t target, ms *minerSectors, tsk types.TipSetKey,
+	at *timeToHeight.Resolution, dims []sectorreport.Dimension, thresholds sectorreport.Thresholds, deals *dealcache.Cache) (Report, error) {
+	pol, err := extension.LoadPolicy(ctx, delegate, tsk)
+	if err != nil {
+		return Report{}, fmt.Errorf("load network policy: %w", err)
+	}
+	fee := terminationFee(pol)
 
+	var claims map[abi.SectorNumber][]extension.Claim
+	if *detail {
+		claims, err = extension.LoadClaims(ctx, delegate, t.addr, tsk)
+		if err != nil {
+			return Report{}, fmt.Errorf("get miner claims: %w", err)
 		}
-		s := SectorInfoByDate{
-			Date:     day,
-			DcCount:  DCCount,
-			CcCount:  CCCount,
-			OdCount:  ODCount,
-			DCPledge: DCPledge,
-			CcPledge: CCPledge,
-			OdPledge: ODPledge,
+	}
+
+	var details []SectorDetail
+	for _, sector := range ms.all {
+		if !*detail {
+			break
 		}
-		sectorInfoByDate = append(sectorInfoByDate, s)
-
-		dc += DCCount
-		cc += CCCount
-		od += ODCount
-		ccp += CCPledge
-		dcp += DCPledge
-		odp += ODPledge
-
-	}
-	sort.Sort(SortByDate(sectorInfoByDate))
-	for _, s := range sectorInfoByDate {
-		fmt.Printf("%s: cc sector %d个，质押：%.4f Fil,dc sector %d个，质押：%.4f Fil,od sector %d个，质押：%.4f Fil\t 共计sector %d个，质押：%.4f Fil\n",
-			s.Date,
-			s.CcCount,
-			s.CcPledge,
-			s.DcCount,
-			s.DCPledge,
-			s.OdCount,
-			s.OdPledge,
-			s.DcCount+s.CcCount+s.OdCount,
-			s.CcPledge+s.DCPledge+s.OdPledge)
-	}
-
-	fmt.Println("==============集群总览===============")
-	fmt.Printf("cc sector \t%d个，质押：%.4f Fil\nod sector \t%d个，质押：%.4f Fil\ndc sector \t%d个，质押：%.4f Fil\n",
-		cc,
-		ccp,
-		od,
-		odp,
-		dc,
-		dcp)
-	fmt.Printf("共计sector \t%d个，质押：%.4f Fil\n", dc+cc+od, ccp+dcp+odp)
-}
 
-func divideBy10ToThe18thDecimal(ta abi.TokenAmount) decimal.Decimal {
+		sectorDeals := lookupDeals(ctx, deals, sector)
+		var dealStartEpochs []int
+		for _, d := range sectorDeals {
+			dealStartEpochs = append(dealStartEpochs, int(d.Proposal.StartEpoch))
+		}
 
-	num, _ := decimal.NewFromString(fmt.Sprintf("%s", ta))
+		details = append(details, SectorDetail{
+			Type:               sectorreport.Classify(sector, thresholds),
+			Status:             ms.statusOf(sector.SectorNumber),
+			Sector:             sector.SectorNumber,
+			Activation:         sector.Activation,
+			ActivationTime:     timeToHeight.HeightToTime(sector.Activation),
+			Eligibility:        pol.Evaluate(sector, claims[sector.SectorNumber], sectorDeals),
+			Expiration:         sector.Expiration,
+			ExpirationTime:     timeToHeight.HeightToTime(sector.Expiration),
+			DealWeight:         sector.DealWeight,
+			VerifiedDealWeight: sector.VerifiedDealWeight,
+			InitialPledge:      sectorreport.AttoFilToFil(sector.InitialPledge),
+			TerminationFee:     sectorreport.AttoFilToFil(fee(sector)),
+			DealIDs:            sector.DeprecatedDealIDs,
+			DealStartEpochs:    dealStartEpochs,
+		})
+	}
+
+	sectorInfoByDate := sectorreport.Group(ms.live, dims, sectorreport.Options{
+		TerminationFee: fee,
+		Status:         ms.statusOf,
+		Thresholds:     thresholds,
+	})
+
+	return Report{
+		Cluster: t.Cluster,
+		Miner:   t.addr.String(),
+		At:      at,
+		GroupBy: sectorreport.DimensionNames(dims),
+		Days:    sectorInfoByDate,
+		Total:   sectorreport.Sum(sectorInfoByDate),
+		Sectors: details,
+
+		WithStatus: ms.statuses != nil,
+		Terminated: len(ms.all) - len(ms.live),
+	}, nil
+}
+
+// resolvePoint resolves a -d style dateTime, or a tipset key given as
+// comma separated cids, optionally in braces.
+func resolvePoint(ctx context.Context, delegate lotusclient.Node, s string) (*timeToHeight.Resolution, error) {
+	if !strings.Contains(s, " ") {
+		var cids []cid.Cid
+		for _, c := range strings.Split(strings.Trim(s, "{}"), ",") {
+			id, err := cid.Decode(strings.TrimSpace(c))
+			if err != nil {
+				return nil, fmt.Errorf("%q is neither a dateTime nor a tipset key", s)
+			}
+			cids = append(cids, id)
+		}
+		ts, err := delegate.ChainGetTipSet(ctx, types.NewTipSetKey(cids...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tipset %s: %w", s, err)
+		}
+		r := timeToHeight.At(ts)
+		return &r, nil
+	}
 
-	tenToThe18th := decimal.NewFromInt(1e18)
+	dateTime, err := timeToHeight.StrToTime(s)
+	if err != nil {
+		return nil, fmt.Errorf("wrong datetime format %q", s)
+	}
 
-	result := num.Div(tenToThe18th)
+	var r timeToHeight.Resolution
+	if *exact {
+		r, err = timeToHeight.Resolve(ctx, delegate, dateTime)
+	} else {
+		r, err = timeToHeight.Lookup(ctx, delegate, dateTime)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain tsk of specified height: %w", err)
+	}
+	return &r, nil
+}
 
-	return result
+func lookupDeals(ctx context.Context, deals *dealcache.Cache, sector *miner.SectorOnChainInfo) []*api.MarketDeal {
+	var sectorDeals []*api.MarketDeal
+	for _, dealID := range sector.DeprecatedDealIDs {
+		dealInfo, err := deals.Get(ctx, dealID)
+		if err != nil {
+			log.Printf("failed to get deal info, err: %s\n", err)
+			continue
+		}
+		sectorDeals = append(sectorDeals, dealInfo)
+	}
+	return sectorDeals
 }
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	miner16 "github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/lotustest"
+	"check-sector-info/sqlexec"
+	timeToHeight "check-sector-info/time-height"
+)
+
+// TestMain runs main instead of the tests when re-executed by run, so that
+// log.Fatalf and the flag globals stay per invocation.
+func TestMain(m *testing.M) {
+	if os.Getenv("CHECK_SECTOR_INFO_MAIN") != "" {
+		sqlexec.Driver = lotustest.DriverName
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func run(t *testing.T, args ...string) string {
+	t.Helper()
+	out, stderr, err := runExit(args...)
+	if err != nil {
+		t.Fatalf("%s: %s\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return out
+}
+
+// runExit is run for the invocations expected to fail, it returns stdout,
+// stderr and the exit error.
+func runExit(args ...string) (string, string, error) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CHECK_SECTOR_INFO_MAIN=1", "FULLNODE_API_INFO=", "TOKEN=", "CSI_CONFIG="+os.DevNull)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	return string(out), stderr.String(), err
+}
+
+const (
+	head = abi.ChainEpoch(4000000)
+	// 2024-01-01 00:00:00 UTC, a null round on the test chain
+	newYear = abi.ChainEpoch(3525360)
+)
+
+func testChain(t *testing.T) (*lotustest.Chain, address.Address) {
+	maddr, err := address.NewIDAddress(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	od := lotustest.Sector(3, 3000000, 4300000, lotustest.FIL(3))
+	od.DealWeight = big.NewInt(1 << 40)
+
+	return &lotustest.Chain{
+		Head: head,
+		Null: map[abi.ChainEpoch]bool{newYear: true},
+		Miners: map[address.Address]*lotustest.Miner{
+			maddr: {
+				Sectors: []*miner.SectorOnChainInfo{
+					lotustest.Sector(1, 3000000, 4100000, lotustest.FIL(1)),
+					lotustest.Sector(2, 3000000, 4100001, lotustest.FIL(2)),
+					od,
+					lotustest.Sector(4, 3000000, 4100000, lotustest.FIL(4)),
+				},
+				Faulty: map[abi.SectorNumber]bool{4: true},
+			},
+		},
+	}, maddr
+}
+
+func TestReportJSON(t *testing.T) {
+	chain, maddr := testChain(t)
+	srv := lotustest.NewServer(t, chain)
+
+	var r Report
+	out := run(t, "-l", srv.URL, "-m", maddr.String(), "-f", "json", "-network", "mainnet", "-tz", "UTC")
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+
+	conv := timeToHeight.NewConverter(timeToHeight.Mainnet, time.UTC)
+	if len(r.Days) != 2 || r.Days[0].Date != conv.HeightToDay(4100000) || r.Days[1].Date != conv.HeightToDay(4300000) {
+		t.Fatalf("days = %+v", r.Days)
+	}
+	if r.Days[0].CcCount != 2 || r.Days[1].OdCount != 1 {
+		t.Errorf("day counts = %+v", r.Days)
+	}
+	// the faulty sector is not active
+	if r.Total.Count() != 3 || !r.Total.Pledge().Equal(decimal.NewFromInt(6)) {
+		t.Errorf("total %d sectors %s fil, want 3 and 6", r.Total.Count(), r.Total.Pledge())
+	}
+	if srv.Calls("StateMinerActiveSectors") != 1 {
+		t.Errorf("StateMinerActiveSectors called %d times", srv.Calls("StateMinerActiveSectors"))
+	}
+}
+
+// TestReportDealClasses checks that verified sectors are told apart by their
+// market deals, which the json api does not return with the sectors.
+func TestReportDealClasses(t *testing.T) {
+	chain, maddr := testChain(t)
+	dc := lotustest.Sector(5, 3000000, 4300000, lotustest.FIL(5))
+	dc.VerifiedDealWeight = big.NewInt(1 << 40)
+	ddo := lotustest.Sector(6, 3000000, 4300000, lotustest.FIL(6))
+	ddo.VerifiedDealWeight = big.NewInt(1 << 40)
+	chain.Miners[maddr].Sectors = append(chain.Miners[maddr].Sectors, dc, ddo)
+	chain.Deals = map[abi.DealID]*api.MarketDeal{
+		42: {
+			Proposal: market.DealProposal{Provider: maddr, VerifiedDeal: true, StartEpoch: 3000000, EndEpoch: 4300000},
+			State:    api.MarketDealState{SectorNumber: 5, SectorStartEpoch: 3000000, LastUpdatedEpoch: -1, SlashEpoch: -1},
+		},
+	}
+	srv := lotustest.NewServer(t, chain)
+
+	for _, c := range []struct {
+		args    []string
+		dc, ddo int
+	}{
+		{nil, 1, 1},
+		{[]string{"-bulk-deals"}, 1, 1},
+		// without the deal ids no sector is known to have no deals
+		{[]string{"-sector-deals=false"}, 2, 0},
+	} {
+		var r Report
+		out := run(t, append([]string{"-l", srv.URL, "-m", maddr.String(), "-f", "json", "-network", "mainnet", "-tz", "UTC"}, c.args...)...)
+		if err := json.Unmarshal([]byte(out), &r); err != nil {
+			t.Fatalf("decode %q: %s", out, err)
+		}
+		if r.Total.DcCount != c.dc || r.Total.DdoCount != c.ddo || r.Total.OdCount != 1 {
+			t.Errorf("%v: total = %+v", c.args, r.Total)
+		}
+	}
+	// the deals themselves are only read for -v
+	if n := srv.Calls("StateMarketStorageDeal"); n != 0 {
+		t.Errorf("StateMarketStorageDeal called %d times without -v", n)
+	}
+	run(t, "-l", srv.URL, "-m", maddr.String(), "-v", "-network", "mainnet", "-tz", "UTC")
+	if n := srv.Calls("StateMarketStorageDeal"); n != 1 {
+		t.Errorf("StateMarketStorageDeal called %d times with -v", n)
+	}
+}
+
+func TestReportStatus(t *testing.T) {
+	chain, maddr := testChain(t)
+	srv := lotustest.NewServer(t, chain)
+
+	var r Report
+	out := run(t, "-l", srv.URL, "-m", maddr.String(), "-status", "-f", "json", "-network", "mainnet", "-tz", "UTC")
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	if r.Total.Count() != 4 || r.Total.FaultyCount != 1 || !r.Total.FaultyPledge.Equal(decimal.NewFromInt(4)) {
+		t.Errorf("total = %+v", r.Total)
+	}
+}
+
+func TestReportAtDate(t *testing.T) {
+	chain, maddr := testChain(t)
+	srv := lotustest.NewServer(t, chain)
+
+	for _, tc := range []struct {
+		exact bool
+		want  abi.ChainEpoch
+	}{
+		{false, newYear - 1},
+		{true, newYear - 1},
+	} {
+		args := []string{"-l", srv.URL, "-m", maddr.String(), "-f", "json", "-network", "mainnet", "-tz", "UTC", "-d", "2024-01-01 00:00:00"}
+		if tc.exact {
+			args = append(args, "-exact")
+		}
+		var r Report
+		if err := json.Unmarshal([]byte(run(t, args...)), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.At == nil || r.At.Height != tc.want || r.At.Estimate != newYear || r.At.Exact != tc.exact {
+			t.Errorf("exact=%v: at = %+v, want height %d", tc.exact, r.At, tc.want)
+		}
+	}
+}
+
+func TestReportText(t *testing.T) {
+	chain, maddr := testChain(t)
+	srv := lotustest.NewServer(t, chain)
+
+	out := run(t, "-l", srv.URL, "-m", maddr.String(), "-network", "mainnet", "-tz", "UTC")
+	for _, want := range []string{"集群总览", timeToHeight.NewConverter(timeToHeight.Mainnet, time.UTC).HeightToDay(4300000)} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReportReplay(t *testing.T) {
+	chain, maddr := testChain(t)
+	srv := lotustest.NewServer(t, chain)
+	dir := t.TempDir()
+
+	args := []string{"-m", maddr.String(), "-status", "-f", "json", "-network", "mainnet", "-tz", "UTC"}
+	recorded := run(t, append([]string{"-l", srv.URL, "-record", dir}, args...)...)
+	calls := srv.Calls("StateMinerSectors")
+
+	replayed := run(t, append([]string{"-replay", dir}, args...)...)
+	if replayed != recorded {
+		t.Errorf("replay differs from the recorded run:\n%s\n%s", recorded, replayed)
+	}
+	if srv.Calls("StateMinerSectors") != calls {
+		t.Error("replay called the node")
+	}
+}
+
+func TestReportByCluster(t *testing.T) {
+	chain, maddr := testChain(t)
+	srv := lotustest.NewServer(t, chain)
+	dsn := lotustest.NewDB(t, []lotustest.Cluster{{Name: "xc64", Miner: maddr.String()}})
+	cfg := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfg, []byte("db:\n  dsn: "+dsn+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var r Report
+	out := run(t, "-config", cfg, "-l", srv.URL, "-c", "xc64", "-f", "json", "-network", "mainnet", "-tz", "UTC")
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	if r.Cluster != "xc64" || r.Miner != maddr.String() {
+		t.Errorf("report of cluster %q miner %q", r.Cluster, r.Miner)
+	}
+
+	// a quote in the name must not widen the lookup to every cluster
+	cmd := exec.Command(os.Args[0], "-config", cfg, "-l", srv.URL, "-c", "x' OR '1'='1", "-f", "json", "-network", "mainnet")
+	cmd.Env = append(os.Environ(), "CHECK_SECTOR_INFO_MAIN=1")
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("hostile cluster name resolved:\n%s", out)
+	}
+	stmts := lotustest.Statements(t, dsn)
+	if last := stmts[len(stmts)-1]; len(last.Args) != 1 || last.Args[0] != "x' OR '1'='1" {
+		t.Errorf("last statement = %+v", last)
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	chain, maddr := testChain(t)
+	// sector 2 moves next to sector 1 in a second partition of deadline 1
+	chain.Miners[maddr].Locations = map[abi.SectorNumber][2]uint64{2: {1, 1}}
+	srv := lotustest.NewServer(t, chain)
+	args := []string{"-l", srv.URL, "-m", maddr.String(), "-mode", "deadlines", "-network", "mainnet", "-tz", "UTC"}
+
+	text := run(t, args...)
+	for _, line := range []string{
+		"deadline  0: 分区0个, sector 0个，质押：0.0000 Fil,cc 0个/0.0000 Fil,dc 0个/0.0000 Fil,od 0个/0.0000 Fil,faulty 0个,recovering 0个\n",
+		"deadline  1: 分区2个, sector 2个，质押：3.0000 Fil,cc 2个/3.0000 Fil,dc 0个/0.0000 Fil,od 0个/0.0000 Fil,faulty 0个,recovering 0个,最早到期：4100000(2024-07-18),最晚到期：4100001(2024-07-18)\n",
+		"  partition 1: sector 1个，质押：2.0000 Fil,cc 1个/2.0000 Fil,dc 0个/0.0000 Fil,od 0个/0.0000 Fil,faulty 0个,recovering 0个,最早到期：4100001(2024-07-18),最晚到期：4100001(2024-07-18)\n",
+		"deadline  4: 分区1个, sector 1个，质押：4.0000 Fil,cc 1个/4.0000 Fil,dc 0个/0.0000 Fil,od 0个/0.0000 Fil,faulty 1个,recovering 0个,最早到期：4100000(2024-07-18),最晚到期：4100000(2024-07-18)\n",
+		"共计sector \t4个，质押：10.0000 Fil，faulty 1个，recovering 0个\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("text output misses %q:\n%s", line, text)
+		}
+	}
+
+	csv := strings.Split(strings.TrimSpace(run(t, append(args, "-f", "csv")...)), "\n")
+	// a row per deadline and one per partition that holds sectors
+	if len(csv) != 1+48+4 {
+		t.Fatalf("%d csv lines:\n%s", len(csv), strings.Join(csv, "\n"))
+	}
+	if want := "deadline,partition,earliest_expiration,latest_expiration,cc_count,cc_pledge,dc_count,dc_pledge,od_count,od_pledge,mixed_count,mixed_pledge,ddo_count,ddo_pledge,unclassified_count,unclassified_pledge,active_count,active_pledge,faulty_count,faulty_pledge,recovering_count,recovering_pledge,total_count,total_pledge"; csv[0] != want {
+		t.Errorf("csv header %s", csv[0])
+	}
+	for i, want := range []string{
+		"0,all,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0",
+		"1,0,4100000,4100000,1,1,0,0,0,0,0,0,0,0,0,0,1,1,0,0,0,0,1,1",
+		"1,1,4100001,4100001,1,2,0,0,0,0,0,0,0,0,0,0,1,2,0,0,0,0,1,2",
+		"1,all,4100000,4100001,2,3,0,0,0,0,0,0,0,0,0,0,2,3,0,0,0,0,2,3",
+		"2,all,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0",
+		"3,0,4300000,4300000,0,0,0,0,1,3,0,0,0,0,0,0,1,3,0,0,0,0,1,3",
+		"3,all,4300000,4300000,0,0,0,0,1,3,0,0,0,0,0,0,1,3,0,0,0,0,1,3",
+		"4,0,4100000,4100000,1,4,0,0,0,0,0,0,0,0,0,0,0,0,1,4,0,0,1,4",
+		"4,all,4100000,4100000,1,4,0,0,0,0,0,0,0,0,0,0,0,0,1,4,0,0,1,4",
+	} {
+		if csv[1+i] != want {
+			t.Errorf("csv line %d = %s, want %s", 1+i, csv[1+i], want)
+		}
+	}
+
+	var r DeadlineReport
+	out := run(t, append(args, "-f", "json")...)
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	if len(r.Deadlines) != 48 || len(r.Deadlines[1].Partitions) != 2 || r.Deadlines[1].Partitions[1].Count() != 1 ||
+		r.Total.Count() != 4 || r.Total.FaultyCount != 1 || !r.Total.Pledge().Equal(decimal.NewFromInt(10)) {
+		t.Errorf("json report %+v", r)
+	}
+}
+
+func TestPlanExtend(t *testing.T) {
+	chain, maddr := testChain(t)
+	chain.Miners[maddr].Locations = map[abi.SectorNumber][2]uint64{2: {1, 1}}
+	srv := lotustest.NewServer(t, chain)
+	dir := t.TempDir()
+
+	var plan ExtendPlan
+	out := run(t, "-l", srv.URL, "-m", maddr.String(), "-mode", "plan-extend", "-to", "+540", "-plan-dir", dir,
+		"-f", "json", "-network", "mainnet", "-tz", "UTC")
+	if err := json.Unmarshal([]byte(out), &plan); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	// the faulty sector 4 is not active and not planned
+	if plan.Target != head+540*builtin.EpochsInDay || plan.Sectors != 3 || len(plan.Batches) != 1 {
+		t.Fatalf("plan %+v", plan)
+	}
+
+	b, err := os.ReadFile(plan.Batches[0].HexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params miner16.ExtendSectorExpiration2Params
+	if err := params.UnmarshalCBOR(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ext := range params.Extensions {
+		sectors, err := ext.Sectors.All(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d/%d %v %d", ext.Deadline, ext.Partition, sectors, ext.NewExpiration))
+	}
+	target := fmt.Sprint(plan.Target)
+	if want := []string{"1/0 [1] " + target, "1/1 [2] " + target, "3/0 [3] " + target}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("declarations %q, want %q", got, want)
+	}
+}
+
+// fleetConfig adds miner f01235 to the test chain and lists both miners in
+// the ops db, with a third cluster whose miner is not on chain.
+func fleetConfig(t *testing.T) (*lotustest.Server, string) {
+	chain, maddr := testChain(t)
+	m2, err := address.NewIDAddress(1235)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Miners[m2] = &lotustest.Miner{Sectors: []*miner.SectorOnChainInfo{lotustest.Sector(1, 3000000, 4100000, lotustest.FIL(10))}}
+	srv := lotustest.NewServer(t, chain)
+	dsn := lotustest.NewDB(t, []lotustest.Cluster{
+		{Name: "xc64", Miner: maddr.String()},
+		{Name: "hk01", Miner: m2.String()},
+		{Name: "gone", Miner: "f09999"},
+	})
+	cfg := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfg, []byte("db:\n  dsn: "+dsn+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return srv, cfg
+}
+
+func checkFleet(t *testing.T, r FleetReport) {
+	t.Helper()
+	if len(r.Clusters) != 2 || r.Clusters[0].Cluster != "xc64" || r.Clusters[1].Cluster != "hk01" || r.Clusters[1].Miner != "f01235" {
+		t.Fatalf("clusters %+v", r.Clusters)
+	}
+	conv := timeToHeight.NewConverter(timeToHeight.Mainnet, time.UTC)
+	if len(r.Days) != 2 || r.Days[0].Date != conv.HeightToDay(4100000) || r.Days[0].CcCount != 3 || r.Days[1].OdCount != 1 {
+		t.Errorf("rollup days %+v", r.Days)
+	}
+	if r.Total.Count() != 4 || !r.Total.Pledge().Equal(decimal.NewFromInt(16)) {
+		t.Errorf("rollup total %d sectors %s fil, want 4 and 16", r.Total.Count(), r.Total.Pledge())
+	}
+}
+
+func TestFleet(t *testing.T) {
+	srv, cfg := fleetConfig(t)
+	args := []string{"-config", cfg, "-l", srv.URL, "-network", "mainnet", "-tz", "UTC", "-attempts", "1"}
+
+	var r FleetReport
+	out := run(t, append(args, "-c", "xc64", "-c", "hk01", "-f", "json")...)
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	checkFleet(t, r)
+	if len(r.Errors) != 0 {
+		t.Errorf("errors %+v", r.Errors)
+	}
+
+	// the rollup rows follow the per miner rows
+	var rollup []string
+	for _, line := range strings.Split(run(t, append(args, "-c", "xc64,hk01", "-f", "csv")...), "\n") {
+		if strings.HasPrefix(line, "fleet,") {
+			rollup = append(rollup, strings.Join(strings.Split(line, ",")[:6], ","))
+		}
+	}
+	want := []string{"fleet,,2024-07-18,3,13,1.105", "fleet,,2024-09-25,0,0,0", "fleet,,total,3,13,1.105"}
+	if strings.Join(rollup, "\n") != strings.Join(want, "\n") {
+		t.Errorf("csv rollup\n%s\nwant\n%s", strings.Join(rollup, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestFleetFailure checks that -all reports the miners that answered and
+// exits non-zero for the one that did not.
+func TestFleetFailure(t *testing.T) {
+	srv, cfg := fleetConfig(t)
+
+	out, stderr, err := runExit("-config", cfg, "-l", srv.URL, "-all", "-f", "json", "-network", "mainnet", "-tz", "UTC", "-attempts", "1")
+	if err == nil || !strings.Contains(stderr, "1 of 3 miners failed") {
+		t.Fatalf("exit %v\n%s", err, stderr)
+	}
+	var r FleetReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	checkFleet(t, r)
+	if len(r.Errors) != 1 || r.Errors[0].Cluster != "gone" || r.Errors[0].Miner != "f09999" {
+		t.Errorf("errors %+v", r.Errors)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// ParseAPIInfo splits a FULLNODE_API_INFO style "token:multiaddr" string and
+// turns the address into an rpc url. The token is optional, the address may
+// also be a plain url, which gets /rpc/v1 unless it names an rpc path.
+func ParseAPIInfo(s string) (token, rpcURL string, err error) {
+	addr := s
+	if !strings.HasPrefix(s, "/") {
+		i := strings.Index(s, ":")
+		if i < 0 {
+			return "", "", fmt.Errorf("api info %q is not in token:multiaddr form", s)
+		}
+		// a url's scheme is the only other thing before the first colon
+		if i != strings.Index(s, "://") {
+			token, addr = s[:i], s[i+1:]
+		}
+	}
+
+	if strings.HasPrefix(addr, "/") {
+		ma, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return "", "", fmt.Errorf("parse api address %q: %w", addr, err)
+		}
+		_, hostport, err := manet.DialArgs(ma)
+		if err != nil {
+			return "", "", fmt.Errorf("parse api address %q: %w", addr, err)
+		}
+		scheme := "ws"
+		if _, err := ma.ValueForProtocol(multiaddr.P_HTTPS); err == nil {
+			scheme = "wss"
+		} else if _, err := ma.ValueForProtocol(multiaddr.P_WSS); err == nil {
+			scheme = "wss"
+		}
+		return token, scheme + "://" + hostport + "/rpc/v1", nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", "", fmt.Errorf("api address %q is not a url or multiaddr", addr)
+	}
+	if strings.HasPrefix(u.Path, "/rpc/") {
+		return token, addr, nil
+	}
+	return token, strings.TrimSuffix(addr, "/") + "/rpc/v1", nil
+}
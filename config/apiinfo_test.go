@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestParseAPIInfo(t *testing.T) {
+	for _, tc := range []struct {
+		in, token, url string
+	}{
+		{"eyJhbGciOiJIUzI1NiJ9.eyJBbGxvdyI6WyJyZWFkIl19.abc:/ip4/10.0.0.5/tcp/1234/http", "eyJhbGciOiJIUzI1NiJ9.eyJBbGxvdyI6WyJyZWFkIl19.abc", "ws://10.0.0.5:1234/rpc/v1"},
+		{"/ip4/127.0.0.1/tcp/1234/http", "", "ws://127.0.0.1:1234/rpc/v1"},
+		{"tok:/dns4/lotus.example.com/tcp/443/https", "tok", "wss://lotus.example.com:443/rpc/v1"},
+		{"tok:https://lotus.example.com", "tok", "https://lotus.example.com/rpc/v1"},
+		{"http://10.0.0.5:1234/", "", "http://10.0.0.5:1234/rpc/v1"},
+		{"ws://10.0.0.5:1234/rpc/v0", "", "ws://10.0.0.5:1234/rpc/v0"},
+	} {
+		token, url, err := ParseAPIInfo(tc.in)
+		if err != nil {
+			t.Errorf("%s: %s", tc.in, err)
+			continue
+		}
+		if token != tc.token || url != tc.url {
+			t.Errorf("%s: got %q %q, want %q %q", tc.in, token, url, tc.token, tc.url)
+		}
+	}
+
+	for _, in := range []string{"tok:/ip4/not-an-ip/tcp/1", "no-address", "tok:no-scheme"} {
+		if _, _, err := ParseAPIInfo(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package config loads the yaml file shared by check-sector-info,
+// daily-script and the rebuild tool.
+//
+// The file is the one named by -config, else by $CSI_CONFIG, else the first
+// of these that exists:
+//
+//	./check-sector-info.yaml
+//	$XDG_CONFIG_HOME/check-sector-info/config.yaml (~/.config/... by default)
+//	/etc/check-sector-info/config.yaml
+//
+// Running without any file is fine, every setting has a flag. The CSI_*
+// variables listed in envOverrides win over the file, flags win over both.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+const FileName = "check-sector-info.yaml"
+
+type Config struct {
+	Lotus Lotus `yaml:"lotus"`
+	DB    DB    `yaml:"db"`
+	// Network is mainnet, calibnet or devnet:<genesis>[:<block delay>],
+	// detected from the node when empty.
+	Network string `yaml:"network"`
+	// TZ is the time zone of dates, the machine's zone when empty.
+	TZ       string   `yaml:"tz"`
+	Output   Output   `yaml:"output"`
+	Classify Classify `yaml:"classify"`
+
+	// Path is the file the config was read from, empty if none was found.
+	Path string `yaml:"-"`
+}
+
+type Lotus struct {
+	// URL is one or more comma separated endpoints, urls, multiaddrs or
+	// token:multiaddr like FULLNODE_API_INFO. The rebuild tool uses the
+	// first one.
+	URL     string   `yaml:"url"`
+	Token   string   `yaml:"token"`
+	Headers []string `yaml:"headers"`
+}
+
+type DB struct {
+	// DSN of the ops database holding cluster_list and the expiration table,
+	// see sqlexec.ParseDSN for the backends.
+	DSN string `yaml:"dsn"`
+}
+
+type Output struct {
+	Format  string `yaml:"format"`
+	Group   string `yaml:"group"`
+	Workers int    `yaml:"workers"`
+	Jobs    int    `yaml:"jobs"`
+}
+
+// Classify are the sectorreport.Thresholds.
+type Classify struct {
+	MinDealWeight int64   `yaml:"min_deal_weight"`
+	MixedDCShare  float64 `yaml:"mixed_dc_share"`
+}
+
+var envOverrides = []struct {
+	name string
+	set  func(c *Config, v string) error
+}{
+	{"CSI_LOTUS_URL", func(c *Config, v string) error { c.Lotus.URL = v; return nil }},
+	{"CSI_LOTUS_TOKEN", func(c *Config, v string) error { c.Lotus.Token = v; return nil }},
+	{"CSI_DSN", func(c *Config, v string) error { c.DB.DSN = v; return nil }},
+	{"CSI_NETWORK", func(c *Config, v string) error { c.Network = v; return nil }},
+	{"CSI_TZ", func(c *Config, v string) error { c.TZ = v; return nil }},
+	{"CSI_FORMAT", func(c *Config, v string) error { c.Output.Format = v; return nil }},
+	{"CSI_GROUP", func(c *Config, v string) error { c.Output.Group = v; return nil }},
+	{"CSI_MIN_DEAL_WEIGHT", func(c *Config, v string) (err error) {
+		c.Classify.MinDealWeight, err = strconv.ParseInt(v, 10, 64)
+		return err
+	}},
+	{"CSI_MIXED_DC_SHARE", func(c *Config, v string) (err error) {
+		c.Classify.MixedDCShare, err = strconv.ParseFloat(v, 64)
+		return err
+	}},
+}
+
+// SearchPaths are the files tried in order when no path is given.
+func SearchPaths() []string {
+	paths := []string{FileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "check-sector-info", "config.yaml"))
+	}
+	return append(paths, "/etc/check-sector-info/config.yaml")
+}
+
+// Load reads path, or $CSI_CONFIG, or the first of SearchPaths that exists,
+// and applies the environment overrides. A path that was asked for must
+// exist.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv("CSI_CONFIG")
+	}
+
+	c := &Config{}
+	if path == "" {
+		for _, p := range SearchPaths() {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse config %s: %w", path, err)
+		}
+		c.Path = path
+	}
+
+	for _, o := range envOverrides {
+		if v, ok := os.LookupEnv(o.name); ok && v != "" {
+			if err := o.set(c, v); err != nil {
+				return nil, fmt.Errorf("bad %s %q: %w", o.name, v, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// SetFlags sets the flags of fs that were not given on the command line to
+// the non-empty values, keyed by flag name.
+func SetFlags(fs *flag.FlagSet, values map[string]string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, v := range values {
+		if given[name] || v == "" {
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("config value %q for -%s: %w", v, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func write(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoad(t *testing.T) {
+	p := write(t, `
+lotus:
+  url: ws://10.0.0.1:1234/rpc/v1,ws://10.0.0.2:1234/rpc/v1
+  token: secret
+  headers: ["X-Cluster: hk01"]
+db:
+  dsn: user:pass@tcp(db:3306)/ops
+network: calibnet
+tz: Asia/Shanghai
+output:
+  format: csv
+  jobs: 8
+classify:
+  min_deal_weight: 100
+  mixed_dc_share: 0.9
+`)
+	t.Setenv("CSI_TZ", "UTC")
+	t.Setenv("CSI_MIXED_DC_SHARE", "0.95")
+
+	c, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Path != p || c.Lotus.Token != "secret" || len(c.Lotus.Headers) != 1 || c.DB.DSN != "user:pass@tcp(db:3306)/ops" ||
+		c.Network != "calibnet" || c.Output.Format != "csv" || c.Output.Jobs != 8 || c.Classify.MinDealWeight != 100 {
+		t.Errorf("config = %+v", c)
+	}
+	if c.TZ != "UTC" || c.Classify.MixedDCShare != 0.95 {
+		t.Errorf("env overrides not applied: tz %q, share %v", c.TZ, c.Classify.MixedDCShare)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing explicit config loaded")
+	}
+	if _, err := Load(write(t, "lotus:\n  uri: x\n")); err == nil || !strings.Contains(err.Error(), "uri") {
+		t.Errorf("unknown key: err = %v", err)
+	}
+	t.Setenv("CSI_MIN_DEAL_WEIGHT", "lots")
+	if _, err := Load(write(t, "")); err == nil {
+		t.Error("bad CSI_MIN_DEAL_WEIGHT accepted")
+	}
+}
+
+func TestLoadSearchPaths(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	t.Setenv("CSI_CONFIG", "")
+
+	c, err := Load("")
+	if err != nil || c.Path != "" {
+		t.Fatalf("no config: %+v, %v", c, err)
+	}
+
+	xdg := filepath.Join(dir, "xdg", "check-sector-info", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(xdg), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(xdg, []byte("network: calibnet\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := Load(""); err != nil || c.Path != xdg {
+		t.Fatalf("user config: %+v, %v", c, err)
+	}
+
+	if err := os.WriteFile(FileName, []byte("network: mainnet\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := Load(""); err != nil || c.Network != "mainnet" {
+		t.Fatalf("working directory config should win: %+v, %v", c, err)
+	}
+
+	t.Setenv("CSI_CONFIG", xdg)
+	if c, err := Load(""); err != nil || c.Network != "calibnet" {
+		t.Fatalf("CSI_CONFIG should win: %+v, %v", c, err)
+	}
+}
+
+func TestSetFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := fs.String("l", "default", "")
+	tz := fs.String("tz", "", "")
+	j := fs.Int("j", 4, "")
+	if err := fs.Parse([]string{"-l", "given"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetFlags(fs, map[string]string{"l": "config", "tz": "UTC", "j": ""}); err != nil {
+		t.Fatal(err)
+	}
+	if *l != "given" || *tz != "UTC" || *j != 4 {
+		t.Errorf("l=%q tz=%q j=%d", *l, *tz, *j)
+	}
+	if err := SetFlags(fs, map[string]string{"j": "many"}); err == nil {
+		t.Error("bad value accepted")
+	}
+}
@@ -5,36 +5,130 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
-	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-jsonrpc"
-	"github.com/filecoin-project/lotus/api/client"
-	"github.com/filecoin-project/lotus/api/v1api"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/types"
 
+	"check-sector-info/config"
+	"check-sector-info/dealcache"
+	"check-sector-info/lotusclient"
+	"check-sector-info/migrations"
+	"check-sector-info/sectorreport"
 	"check-sector-info/sqlexec"
 	timeToHeight "check-sector-info/time-height"
 )
 
-func ConnectClient(apiUrl string) (v1api.FullNode, jsonrpc.ClientCloser, error) {
-	header := http.Header{}
+func ConnectClient(apiUrl string) (lotusclient.Node, jsonrpc.ClientCloser, error) {
+	if *replayDir != "" && *recordDir != "" {
+		return nil, nil, fmt.Errorf("-record and -replay cannot be used together")
+	}
+	if *replayDir != "" {
+		f, err := lotusclient.NewReplayer(*replayDir)
+		return f, func() {}, err
+	}
+
 	ctx := context.Background()
-	return client.NewFullNodeRPCV1(ctx, apiUrl, header)
+	retry := lotusclient.DefaultRetry
+	retry.CallTimeout = *callTimeout
+	retry.Attempts = *attempts
+	c, closer, err := lotusclient.Connect(ctx, lotusclient.Options{URL: apiUrl, Token: *token, Headers: headers}, retry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *rpcLog {
+		c.Logf = log.Printf
+	}
+
+	if *recordDir != "" {
+		f, err := lotusclient.NewRecorder(*recordDir, c)
+		if err != nil {
+			closer()
+			return nil, nil, err
+		}
+		return f, closer, nil
+	}
+	return c, closer, nil
 }
 
-var url = flag.String("l", "http://127.0.0.1:1234/rpc/v0", "lotusAPI")
-var dsn = flag.String("d", "", "ops dsn")
+var configPath = flag.String("config", "", "config file, defaults to $CSI_CONFIG or the first of "+strings.Join(config.SearchPaths(), ", ")+" that exists")
+var url = flag.String("l", "", "lotusAPI, several separated by commas to fail over between, defaults to the addresses in FULLNODE_API_INFO or "+lotusclient.DefaultURL)
+var token = flag.String("token", "", "lotus API token, defaults to $TOKEN or the token in FULLNODE_API_INFO")
+var headers lotusclient.Headers
+var callTimeout = flag.Duration("timeout", lotusclient.DefaultRetry.CallTimeout, "timeout of each lotus API call attempt")
+var attempts = flag.Int("attempts", lotusclient.DefaultRetry.Attempts, "tries per lotus API call, failing over to the next -l endpoint after each failure")
+var deadline = flag.Duration("deadline", 2*time.Hour, "give up on the whole run after this long, 0 for no limit")
+var recordDir = flag.String("record", "", "save every lotus API response of this run to the directory")
+var replayDir = flag.String("replay", "", "answer lotus API calls from a -record directory instead of a node")
+var rpcLog = flag.Bool("rpc-log", true, "log which lotus endpoint served each call")
+var dsn = flag.String("d", "", "ops dsn, mysql://, postgres:// or sqlite://path, defaults to db.dsn of the config file")
+var network = flag.String("network", "", "mainnet, calibnet or devnet:<genesis unix>[:<block delay>], detected from the node when empty")
+var tz = flag.String("tz", "", "time zone of the expiration dates, example:Asia/Shanghai, defaults to the machine's zone")
+var sectorSnapshot = flag.Bool("sectors", false, "also write every sector of each cluster to filecoin_cluster_sector_snapshot")
+var sectorRetention = flag.Int("sector-retention", 30, "with -sectors, delete the per-sector snapshots older than this many days, 0 keeps them all")
+var bulkDeals = flag.Bool("bulk-deals", false, "load all market deals once with StateMarketDeals to restore the deal ids the json api drops")
+var sectorDeals = flag.Bool("sector-deals", true, "restore the deal ids of each cluster's sectors from the market actor state, needed to tell dc from ddo sectors, requires nv22 or later")
+
+func init() {
+	flag.Var(&headers, "H", "extra http header sent to lotus, \"Key: Value\", can be repeated")
+}
+
+// loadConfig fills the flags not given on the command line from the config
+// file and returns it.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Path != "" {
+		log.Printf("config loaded from %s", cfg.Path)
+	}
+	err = config.SetFlags(flag.CommandLine, map[string]string{
+		"l":       cfg.Lotus.URL,
+		"token":   cfg.Lotus.Token,
+		"network": cfg.Network,
+		"tz":      cfg.TZ,
+		"d":       cfg.DB.DSN,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		for _, h := range cfg.Lotus.Headers {
+			if err := headers.Set(h); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cfg, nil
+}
 
 func main() {
 	flag.Parse()
 
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("load config failed,%s", err)
+	}
+	thresholds := sectorreport.Thresholds{
+		MinDealWeight: cfg.Classify.MinDealWeight,
+		MixedDCShare:  cfg.Classify.MixedDCShare,
+		DealIDsKnown:  *bulkDeals || *sectorDeals,
+	}
+	if *dsn == "" {
+		log.Fatalf("no ops dsn, set -d, db.dsn in the config file or CSI_DSN")
+	}
+
 	//init lotus connext
 	ctx := context.Background()
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
 
 	delegate, closer, err := ConnectClient(*url)
 	if err != nil {
@@ -43,101 +137,158 @@ func main() {
 	log.Println("lotus api connect success")
 	defer closer()
 
+	conv, err := timeToHeight.Configure(ctx, delegate, *network, *tz)
+	if err != nil {
+		log.Fatalf("set up epoch time conversion failed,%s", err)
+	}
+	log.Printf("network %s, time zone %s", conv.Network.Name, conv.Location)
+
 	//init db
-	db, err := sqlexec.InitDB(*dsn)
+	db, dialect, err := sqlexec.InitDB(*dsn)
+	if err != nil {
+		log.Fatalf("init db failed,%s", err)
+	}
+	if err := migrations.Check(ctx, db); err != nil {
+		db.Close()
+		log.Fatalf("refuse to write,%s", err)
+	}
+	repo, err := sqlexec.NewRepository(ctx, db, dialect)
 	if err != nil {
+		db.Close()
 		log.Fatalf("init db failed,%s", err)
 	}
-	defer db.Close()
+	defer repo.Close()
 	log.Println("db init success")
 
 	//get cluster
-	clusterList, err := sqlexec.GetCluster(db)
+	clusterList, err := repo.Clusters(ctx)
 	if err != nil {
-		log.Fatalf("get cluster info failed ")
+		log.Fatalf("get cluster info failed,%s", err)
 	}
 	log.Printf("get cluster info success,number:%d", len(clusterList))
 
-	t := time.Now()
+	var deals *dealcache.Cache
+	if *bulkDeals || *sectorDeals {
+		deals = dealcache.New(delegate, types.EmptyTSK)
+	}
+	if *bulkDeals {
+		if err := deals.LoadAll(ctx); err != nil {
+			log.Fatalf("load market deals failed,%s", err)
+		}
+		log.Println("market deals loaded")
+	}
+
+	t := time.Now().In(conv.Location)
 	updateDate := t.Format("2006-01-02 00:00:00")
 
 	//for loop check and insert
+	var failed int
 	for _, cluster := range clusterList {
 		addr, err := address.NewFromString(cluster.Miner)
 		if err != nil {
 			log.Printf("%s %s convert to address.address failed,%s", cluster.Name, cluster.Miner, err)
+			failed++
 			continue
 		}
 
+		// keep the rows already written today when the chain cannot be read
 		sectorInfoList, err := delegate.StateMinerActiveSectors(ctx, addr, types.EmptyTSK)
 		if err != nil {
-			log.Println(err)
+			log.Printf("%s %s get active sectors failed,existing rows kept,%s", cluster.Name, cluster.Miner, err)
+			failed++
+			continue
 		}
-
-		groups := make(map[string][]miner.SectorOnChainInfo)
-		for _, sector := range sectorInfoList {
-			//var flag bool
-			//if len(sector.DealIDs) != 0 {
-			//	flag = true
-			//} else {
-			//	flag = false
-			//}
-
-			//if *detail == true {
-			//	fmt.Printf("dc:%v,sector:%d,Expiration:%d,date:%s,VerifiedDealWeight:%s,InitialPledge:%s,deadid:%v\n", flag, sector.SectorNumber, sector.Expiration, timeToHeight.HeightToTime(sector.Expiration), sector.VerifiedDealWeight, sector.InitialPledge, sector.DealIDs)
-			//}
-			groups[timeToHeight.HeightToDay(sector.Expiration)] = append(groups[timeToHeight.HeightToDay(sector.Expiration)], *sector)
+		if deals != nil {
+			if !*bulkDeals {
+				if err := deals.LoadSectors(ctx, addr); err != nil {
+					log.Printf("%s %s restore sector deal ids failed,existing rows kept,%s", cluster.Name, cluster.Miner, err)
+					failed++
+					continue
+				}
+			}
+			for _, sector := range sectorInfoList {
+				if len(sector.DeprecatedDealIDs) == 0 {
+					sector.DeprecatedDealIDs = deals.SectorDeals(addr, sector.SectorNumber)
+				}
+			}
 		}
 
-		var cc, dc int
-		var ccp, dcp float64
+		days := sectorreport.GroupByExpirationDay(sectorInfoList, sectorreport.Options{Thresholds: thresholds})
 
-		sql, err := sqlexec.Del(db, cluster.Miner, updateDate)
-		if err != nil {
-			log.Printf("%s %s sql exec failed,sql:%s,err:%s", cluster.Name, cluster.Miner, sql, err)
-			continue
+		rows := make([]sqlexec.ExpirationRow, 0, len(days))
+		for _, day := range days {
+			// the table has cc, od and dc columns, the dc columns hold every
+			// sector with verified weight, ddo and mixed included, and the
+			// unclassified ones so that the totals still add up
+			rows = append(rows, sqlexec.ExpirationRow{
+				Name:       cluster.Name,
+				Miner:      cluster.Miner,
+				Date:       day.Date,
+				DCCount:    day.Count() - day.CcCount - day.OdCount,
+				DCPledge:   day.Pledge().Sub(day.CcPledge).Sub(day.OdPledge),
+				CCCount:    day.CcCount,
+				CCPledge:   day.CcPledge,
+				ODCount:    day.OdCount,
+				ODPledge:   day.OdPledge,
+				UpdateDate: updateDate,
+			})
 		}
-		log.Printf("%s %s sql exec success,sql:%s", cluster.Name, cluster.Miner, sql)
-
-		for day, group := range groups {
 
-			var DCCount, CCCount int
-			var DCPledge, CCPledge float64
-
-			for _, s := range group {
-				str := fmt.Sprintf("%s", s.InitialPledge)
-				a, err := strconv.ParseFloat(str, 64)
-				f := a / math.Pow(10, 18)
-				if err != nil {
-					fmt.Println(err)
-				}
-				if len(s.DeprecatedDealIDs) == 0 {
-					CCCount += 1
-					CCPledge += f
-				} else {
-					DCCount += 1
-					DCPledge += f
-				}
-
-			}
+		if err := repo.ReplaceExpirations(ctx, cluster.Miner, updateDate, rows); err != nil {
+			log.Printf("%s %s write %d days of %s failed,existing rows kept,%s", cluster.Name, cluster.Miner, len(rows), updateDate, err)
+			failed++
+			continue
+		}
+		log.Printf("%s %s wrote %d days of %s", cluster.Name, cluster.Miner, len(rows), updateDate)
 
-			sql, err = sqlexec.Insert(db, cluster.Name, cluster.Miner, day, DCCount, DCPledge, CCCount, CCPledge, updateDate)
-			if err != nil {
-				log.Printf("%s %s sql exec failed,sql:%s,err:%s", cluster.Name, cluster.Miner, sql, err)
+		if *sectorSnapshot {
+			sectors := sectorRows(cluster, sectorInfoList, thresholds, conv, updateDate)
+			if err := repo.ReplaceSectors(ctx, cluster.Miner, updateDate, sectors); err != nil {
+				log.Printf("%s %s write %d sectors of %s failed,existing rows kept,%s", cluster.Name, cluster.Miner, len(sectors), updateDate, err)
+				failed++
 				continue
 			}
-			log.Printf("%s %s sql exec success,sql:%s", cluster.Name, cluster.Miner, sql)
-
-			//fmt.Printf("dc sector %d个，质押：%.4f Fil,cc sector %d个，质押：%.4f Fil\t", DCCount, DCPledge, CCCount, CCPledge)
-			//fmt.Printf("共计sector %d个，质押：%.4f Fil\n", DCCount+CCCount, DCPledge+CCPledge)
-
-			dc += DCCount
-			cc += CCCount
-			ccp += CCPledge
-			dcp += DCPledge
+			log.Printf("%s %s wrote %d sectors of %s", cluster.Name, cluster.Miner, len(sectors), updateDate)
+		}
+	}
 
+	if *sectorSnapshot && *sectorRetention > 0 {
+		before := t.AddDate(0, 0, -*sectorRetention).Format("2006-01-02 00:00:00")
+		n, err := repo.PruneSectors(ctx, before)
+		if err != nil {
+			log.Fatalf("prune sector snapshots before %s failed,%s", before, err)
 		}
+		log.Printf("pruned %d sector rows before %s", n, before)
+	}
 
+	if failed != 0 {
+		log.Fatalf("%d of %d clusters failed", failed, len(clusterList))
 	}
+}
 
+// sectorRows is the per-sector snapshot of a cluster.
+func sectorRows(cluster sqlexec.Cluster, sectors []*miner.SectorOnChainInfo, thresholds sectorreport.Thresholds, conv timeToHeight.Converter, updateDate string) []sqlexec.SectorRow {
+	rows := make([]sqlexec.SectorRow, 0, len(sectors))
+	for _, s := range sectors {
+		row := sqlexec.SectorRow{
+			Name:           cluster.Name,
+			Miner:          cluster.Miner,
+			UpdateDate:     updateDate,
+			SectorNumber:   uint64(s.SectorNumber),
+			Class:          string(sectorreport.Classify(s, thresholds)),
+			Activation:     int64(s.Activation),
+			Expiration:     int64(s.Expiration),
+			ExpirationDate: conv.HeightToDay(s.Expiration),
+			InitialPledge:  sectorreport.AttoFilToFil(s.InitialPledge),
+			SealProof:      int64(s.SealProof),
+		}
+		for _, id := range s.DeprecatedDealIDs {
+			row.DealIDs = append(row.DealIDs, uint64(id))
+		}
+		if s.SectorKeyCID != nil {
+			row.SectorKeyCID = s.SectorKeyCID.String()
+		}
+		rows = append(rows, row)
+	}
+	return rows
 }
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/ipfs/go-cid"
+
+	"check-sector-info/lotustest"
+	"check-sector-info/migrations"
+	"check-sector-info/sqlexec"
+	timeToHeight "check-sector-info/time-height"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("DAILY_SCRIPT_MAIN") != "" {
+		sqlexec.Driver = lotustest.DriverName
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// run runs main with args and returns its log and exit error.
+func run(args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "DAILY_SCRIPT_MAIN=1", "FULLNODE_API_INFO=", "TOKEN=", "CSI_CONFIG="+os.DevNull)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+func TestDailyWrite(t *testing.T) {
+	maddr, err := address.NewIDAddress(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := lotustest.Sector(3, 3000000, 4300000, lotustest.FIL(3))
+	dc.VerifiedDealWeight = big.NewInt(1 << 40)
+
+	srv := lotustest.NewServer(t, &lotustest.Chain{
+		Head: 4000000,
+		Miners: map[address.Address]*lotustest.Miner{
+			maddr: {
+				Sectors: []*miner.SectorOnChainInfo{
+					lotustest.Sector(1, 3000000, 4100000, lotustest.FIL(1)),
+					lotustest.Sector(2, 3000000, 4100001, lotustest.FIL(2)),
+					dc,
+				},
+			},
+		},
+		Deals: map[abi.DealID]*api.MarketDeal{
+			42: {
+				Proposal: market.DealProposal{Provider: maddr, VerifiedDeal: true, StartEpoch: 3000000, EndEpoch: 4300000},
+				State:    api.MarketDealState{SectorNumber: 3, SectorStartEpoch: 3000000, LastUpdatedEpoch: -1, SlashEpoch: -1},
+			},
+		},
+	})
+	dsn := lotustest.NewDB(t, []lotustest.Cluster{
+		{Name: "xc64", Miner: maddr.String()},
+		{Name: "gone", Miner: "f09999"},
+		{Name: "broken", Miner: "not-an-address"},
+	})
+	lotustest.SetSchemaVersion(t, dsn, migrations.Latest())
+
+	conv := timeToHeight.NewConverter(timeToHeight.Mainnet, time.UTC)
+	day := func(h abi.ChainEpoch) string { return conv.HeightToDay(h) }
+	updateDate := time.Now().UTC().Format("2006-01-02 00:00:00")
+	insert := "INSERT INTO filecoin_cluster_sector_expiration(name, miner, date, dc_count, dc_pledge, cc_count, cc_pledge, od_count, od_pledge, update_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "
+	// the miner missing on chain and the bad address are not touched
+	want := []string{
+		"SELECT COALESCE(MAX(version), 0) FROM schema_version []",
+		"SELECT name, f0 FROM cluster_list []",
+		"BEGIN []",
+		"DELETE FROM filecoin_cluster_sector_expiration WHERE miner = ? AND update_date = ? [f01234 " + updateDate + "]",
+		insert + "[xc64 f01234 " + day(4100000) + " 0 0 2 3 0 0 " + updateDate +
+			" xc64 f01234 " + day(4300000) + " 1 3 0 0 0 0 " + updateDate + "]",
+		"COMMIT []",
+	}
+
+	// a rerun on the same day writes the same snapshot again
+	for i := 1; i <= 2; i++ {
+		out, err := run("-l", srv.URL, "-d", dsn, "-network", "mainnet", "-tz", "UTC", "-attempts", "1")
+		if err == nil || !strings.Contains(out, "2 of 3 clusters failed") {
+			t.Fatalf("run %d: err %v, log:\n%s", i, err, out)
+		}
+
+		var got []string
+		for _, s := range lotustest.Statements(t, dsn) {
+			got = append(got, fmt.Sprint(s.Query, " ", s.Args))
+		}
+		var all []string
+		for range i {
+			all = append(all, want...)
+		}
+		if strings.Join(got, "\n") != strings.Join(all, "\n") {
+			t.Errorf("run %d statements:\n%s\nwant:\n%s", i, strings.Join(got, "\n"), strings.Join(all, "\n"))
+		}
+	}
+}
+
+func TestDailyRefusesOldSchema(t *testing.T) {
+	srv := lotustest.NewServer(t, &lotustest.Chain{Head: 4000000})
+	dsn := lotustest.NewDB(t, []lotustest.Cluster{{Name: "xc64", Miner: "f01234"}})
+	lotustest.SetSchemaVersion(t, dsn, migrations.Latest()-1)
+
+	out, err := run("-l", srv.URL, "-d", dsn, "-network", "mainnet", "-tz", "UTC", "-attempts", "1")
+	if err == nil || !strings.Contains(out, "schema is behind") {
+		t.Fatalf("err %v, log:\n%s", err, out)
+	}
+	for _, s := range lotustest.Statements(t, dsn) {
+		if !strings.HasPrefix(s.Query, "SELECT") {
+			t.Errorf("ran %s on an old schema", s.Query)
+		}
+	}
+}
+
+// newSQLite returns the dsn of a migrated sqlite file holding one cluster.
+func newSQLite(t *testing.T, name, miner string) string {
+	ctx := context.Background()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "ops.db")
+	db, dialect, err := sqlexec.InitDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := migrations.Up(ctx, db, dialect, migrations.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO cluster_list(name, f0) VALUES (?, ?)", name, miner); err != nil {
+		t.Fatal(err)
+	}
+	return dsn
+}
+
+// TestDailySQLite runs the whole pipeline on a local sqlite file.
+func TestDailySQLite(t *testing.T) {
+	maddr, err := address.NewIDAddress(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := lotustest.NewServer(t, &lotustest.Chain{
+		Head: 4000000,
+		Miners: map[address.Address]*lotustest.Miner{
+			maddr: {Sectors: []*miner.SectorOnChainInfo{lotustest.Sector(1, 3000000, 4100000, lotustest.FIL(1))}},
+		},
+	})
+
+	ctx := context.Background()
+	dsn := newSQLite(t, "xc64", maddr.String())
+	if out, err := run("-l", srv.URL, "-d", dsn, "-network", "mainnet", "-tz", "UTC", "-attempts", "1"); err != nil {
+		t.Fatalf("err %v, log:\n%s", err, out)
+	}
+
+	repo, err := sqlexec.Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	rows, err := repo.Expirations(ctx, maddr.String(), time.Now().UTC().Format("2006-01-02 00:00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := timeToHeight.NewConverter(timeToHeight.Mainnet, time.UTC).HeightToDay(4100000)
+	if len(rows) != 1 || rows[0].Date != day || rows[0].CCCount != 1 || rows[0].CCPledge.String() != "1" {
+		t.Errorf("rows %+v", rows)
+	}
+}
+
+// TestDailyUpdateDateZone checks that update_date is today in the -tz zone,
+// not in the zone of the machine.
+func TestDailyUpdateDateZone(t *testing.T) {
+	maddr, err := address.NewIDAddress(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := lotustest.NewServer(t, &lotustest.Chain{
+		Head: 4000000,
+		Miners: map[address.Address]*lotustest.Miner{
+			maddr: {Sectors: []*miner.SectorOnChainInfo{lotustest.Sector(1, 3000000, 4100000, lotustest.FIL(1))}},
+		},
+	})
+	// 26 hours apart, the two zones never share a date and one of them is
+	// a different day than the machine's
+	const layout = "2006-01-02 00:00:00"
+	zone := "Pacific/Kiritimati"
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Skip(err)
+	}
+	local := time.Now().Format(layout)
+	if time.Now().In(loc).Format(layout) == local {
+		zone = "Etc/GMT+12"
+		if loc, err = time.LoadLocation(zone); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	ctx := context.Background()
+	dsn := newSQLite(t, "xc64", maddr.String())
+	today := time.Now().In(loc).Format(layout)
+	if out, err := run("-l", srv.URL, "-d", dsn, "-network", "mainnet", "-tz", zone, "-attempts", "1"); err != nil {
+		t.Fatalf("err %v, log:\n%s", err, out)
+	}
+	if time.Now().In(loc).Format(layout) != today || time.Now().Format(layout) != local {
+		t.Skip("the day changed during the run")
+	}
+
+	repo, err := sqlexec.Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	for date, want := range map[string]int{today: 1, local: 0} {
+		rows, err := repo.Expirations(ctx, maddr.String(), date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != want {
+			t.Errorf("%d rows of %s, want %d", len(rows), date, want)
+		}
+	}
+}
+
+func TestDailySectors(t *testing.T) {
+	maddr, err := address.NewIDAddress(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := lotustest.Sector(3, 3000000, 4300000, lotustest.FIL(3))
+	dc.VerifiedDealWeight = big.NewInt(1 << 40)
+	key, err := cid.Parse("bafkqaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.SectorKeyCID = &key
+	ddo := lotustest.Sector(4, 3000000, 4300000, lotustest.FIL(4))
+	ddo.VerifiedDealWeight = big.NewInt(1 << 40)
+
+	srv := lotustest.NewServer(t, &lotustest.Chain{
+		Head: 4000000,
+		Miners: map[address.Address]*lotustest.Miner{
+			maddr: {Sectors: []*miner.SectorOnChainInfo{lotustest.Sector(1, 3000000, 4100000, lotustest.FIL(1)), dc, ddo}},
+		},
+		Deals: map[abi.DealID]*api.MarketDeal{
+			42: {
+				Proposal: market.DealProposal{Provider: maddr, StartEpoch: 3000000, EndEpoch: 4300000},
+				State:    api.MarketDealState{SectorNumber: 3, SectorStartEpoch: 3000000, LastUpdatedEpoch: -1, SlashEpoch: -1},
+			},
+		},
+	})
+	ctx := context.Background()
+	dsn := newSQLite(t, "xc64", maddr.String())
+
+	// a snapshot older than the retention is pruned, a recent one is kept
+	old := time.Now().UTC().AddDate(0, 0, -10).Format("2006-01-02 00:00:00")
+	recent := time.Now().UTC().AddDate(0, 0, -2).Format("2006-01-02 00:00:00")
+	repo, err := sqlexec.Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	for _, date := range []string{old, recent} {
+		row := sqlexec.SectorRow{Name: "xc64", Miner: maddr.String(), UpdateDate: date, SectorNumber: 9, Class: "cc", ExpirationDate: "2027-01-01"}
+		if err := repo.ReplaceSectors(ctx, maddr.String(), date, []sqlexec.SectorRow{row}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := run("-l", srv.URL, "-d", dsn, "-network", "mainnet", "-tz", "UTC", "-attempts", "1",
+		"-sectors", "-sector-retention", "7")
+	if err != nil {
+		t.Fatalf("err %v, log:\n%s", err, out)
+	}
+
+	conv := timeToHeight.NewConverter(timeToHeight.Mainnet, time.UTC)
+	got, err := repo.Sectors(ctx, maddr.String(), time.Now().UTC().Format("2006-01-02 00:00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("sectors %+v", got)
+	}
+	if s := got[0]; s.SectorNumber != 1 || s.Class != "cc" || s.Activation != 3000000 || s.Expiration != 4100000 ||
+		s.ExpirationDate != conv.HeightToDay(4100000) || s.InitialPledge.String() != "1" || len(s.DealIDs) != 0 || s.SectorKeyCID != "" ||
+		s.SealProof != int64(abi.RegisteredSealProof_StackedDrg32GiBV1_1) {
+		t.Errorf("cc sector %+v", s)
+	}
+	if s := got[1]; s.SectorNumber != 3 || s.Class != "dc" || fmt.Sprint(s.DealIDs) != "[42]" || s.SectorKeyCID != key.String() {
+		t.Errorf("dc sector %+v", s)
+	}
+	if s := got[2]; s.SectorNumber != 4 || s.Class != "ddo" || len(s.DealIDs) != 0 {
+		t.Errorf("ddo sector %+v", s)
+	}
+
+	for date, want := range map[string]int{old: 0, recent: 1} {
+		rows, err := repo.Sectors(ctx, maddr.String(), date)
+		if err != nil || len(rows) != want {
+			t.Errorf("snapshot of %s: %d rows, %v, want %d", date, len(rows), err, want)
+		}
+	}
+}
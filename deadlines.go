@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"check-sector-info/output"
+	"check-sector-info/sectorreport"
+	timeToHeight "check-sector-info/time-height"
+)
+
+type DeadlineReport struct {
+	Cluster   string                     `json:"cluster,omitempty"`
+	Miner     string                     `json:"miner"`
+	At        *timeToHeight.Resolution   `json:"at,omitempty"`
+	Deadlines []sectorreport.DeadlineRow `json:"deadlines"`
+	Total     sectorreport.Total         `json:"total"`
+}
+
+func (r DeadlineReport) Write(w io.Writer, f output.Format) error {
+	switch f {
+	case output.JSON:
+		return output.WriteJSON(w, r)
+	case output.NDJSON:
+		if r.At != nil {
+			if err := output.WriteNDJSON(w, "at", r.At); err != nil {
+				return err
+			}
+		}
+		for _, dl := range r.Deadlines {
+			for _, p := range dl.Partitions {
+				rec := struct {
+					Deadline uint64 `json:"deadline"`
+					sectorreport.PartitionRow
+				}{dl.Deadline, p}
+				if err := output.WriteNDJSON(w, "partition", rec); err != nil {
+					return err
+				}
+			}
+			summary := dl
+			summary.Partitions = nil
+			if err := output.WriteNDJSON(w, "deadline", summary); err != nil {
+				return err
+			}
+		}
+		return output.WriteNDJSON(w, "total", r.Total)
+	case output.CSV:
+		return r.writeCSV(w)
+	default:
+		r.writeText(w)
+		return nil
+	}
+}
+
+func (r DeadlineReport) writeText(w io.Writer) {
+	line := func(prefix string, b sectorreport.Bucket) {
+		fmt.Fprintf(w, "%s sector %d个，质押：%s Fil", prefix, b.Count(), b.Pledge().StringFixed(4))
+		for _, c := range []sectorreport.Class{sectorreport.CC, sectorreport.DC, sectorreport.OD} {
+			count, pledge := b.ByClass(c)
+			fmt.Fprintf(w, ",%s %d个/%s Fil", c, count, pledge.StringFixed(4))
+		}
+		if n := b.MixedCount + b.DdoCount + b.UnclassifiedCount; n != 0 {
+			fmt.Fprintf(w, ",其他 %d个", n)
+		}
+		fmt.Fprintf(w, ",faulty %d个,recovering %d个", b.FaultyCount, b.RecoveringCount)
+		if b.Count() != 0 {
+			fmt.Fprintf(w, ",最早到期：%d(%s),最晚到期：%d(%s)",
+				b.EarliestExpiration, timeToHeight.HeightToDay(b.EarliestExpiration),
+				b.LatestExpiration, timeToHeight.HeightToDay(b.LatestExpiration))
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, dl := range r.Deadlines {
+		line(fmt.Sprintf("deadline %2d: 分区%d个,", dl.Deadline, len(dl.Partitions)), dl.Bucket)
+		for _, p := range dl.Partitions {
+			line(fmt.Sprintf("  partition %d:", p.Partition), p.Bucket)
+		}
+	}
+
+	t := r.Total
+	fmt.Fprintln(w, "==============集群总览===============")
+	fmt.Fprintf(w, "共计sector \t%d个，质押：%s Fil，faulty %d个，recovering %d个\n", t.Count(), t.Pledge().StringFixed(4), t.FaultyCount, t.RecoveringCount)
+}
+
+func (r DeadlineReport) writeCSV(w io.Writer) error {
+	t := output.Table{Header: []string{"deadline", "partition", "earliest_expiration", "latest_expiration"}}
+	for _, c := range sectorreport.Classes {
+		t.Header = append(t.Header, string(c)+"_count", string(c)+"_pledge")
+	}
+	for _, st := range sectorreport.Statuses {
+		t.Header = append(t.Header, string(st)+"_count", string(st)+"_pledge")
+	}
+	t.Header = append(t.Header, "total_count", "total_pledge")
+
+	row := func(dl, part string, b sectorreport.Bucket) []string {
+		r := []string{dl, part, b.EarliestExpiration.String(), b.LatestExpiration.String()}
+		for _, c := range sectorreport.Classes {
+			count, pledge := b.ByClass(c)
+			r = append(r, strconv.Itoa(count), pledge.String())
+		}
+		for _, st := range sectorreport.Statuses {
+			count, pledge := b.ByStatus(st)
+			r = append(r, strconv.Itoa(count), pledge.String())
+		}
+		return append(r, strconv.Itoa(b.Count()), b.Pledge().String())
+	}
+
+	for _, dl := range r.Deadlines {
+		dlIdx := strconv.FormatUint(dl.Deadline, 10)
+		for _, p := range dl.Partitions {
+			t.Rows = append(t.Rows, row(dlIdx, strconv.FormatUint(p.Partition, 10), p.Bucket))
+		}
+		t.Rows = append(t.Rows, row(dlIdx, "all", dl.Bucket))
+	}
+	return output.WriteCSV(w, t)
+}
@@ -0,0 +1,166 @@
+package dealcache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+)
+
+type DealAPI interface {
+	StateMarketStorageDeal(context.Context, abi.DealID, types.TipSetKey) (*api.MarketDeal, error)
+	StateMarketDeals(context.Context, types.TipSetKey) (map[string]*api.MarketDeal, error)
+	StateGetActor(context.Context, address.Address, types.TipSetKey) (*types.Actor, error)
+	ChainReadObj(context.Context, cid.Cid) ([]byte, error)
+}
+
+type sectorKey struct {
+	provider abi.ActorID
+	sector   abi.SectorNumber
+}
+
+type entry struct {
+	done chan struct{}
+	deal *api.MarketDeal
+	err  error
+}
+
+// Cache memoizes deal lookups for a single run. Concurrent lookups of the
+// same deal share one RPC, failed lookups are not cached.
+type Cache struct {
+	api DealAPI
+	tsk types.TipSetKey
+
+	lk      sync.Mutex
+	entries map[abi.DealID]*entry
+	bulk    bool
+	sectors map[sectorKey][]abi.DealID
+}
+
+func New(api DealAPI, tsk types.TipSetKey) *Cache {
+	return &Cache{
+		api:     api,
+		tsk:     tsk,
+		entries: make(map[abi.DealID]*entry),
+	}
+}
+
+// LoadAll fetches every deal of the storage market with one
+// StateMarketDeals call, after which Get is served from memory only.
+func (c *Cache) LoadAll(ctx context.Context) error {
+	deals, err := c.api.StateMarketDeals(ctx, c.tsk)
+	if err != nil {
+		return fmt.Errorf("get market deals: %w", err)
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.sectors = make(map[sectorKey][]abi.DealID)
+	for k, d := range deals {
+		id, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deal id %q: %w", k, err)
+		}
+		e := &entry{done: make(chan struct{}), deal: d}
+		close(e.done)
+		c.entries[abi.DealID(id)] = e
+
+		if d.State.SectorStartEpoch < 0 {
+			continue
+		}
+		provider, err := address.IDFromAddress(d.Proposal.Provider)
+		if err != nil {
+			continue
+		}
+		key := sectorKey{provider: abi.ActorID(provider), sector: d.State.SectorNumber}
+		c.sectors[key] = append(c.sectors[key], abi.DealID(id))
+	}
+	for _, ids := range c.sectors {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	c.bulk = true
+	return nil
+}
+
+// SectorDeals returns the builtin market deals activated in the given
+// sector. It is only populated after LoadAll or LoadSectors and is meant to
+// restore the deal ids that the JSON API drops from SectorOnChainInfo.
+func (c *Cache) SectorDeals(maddr address.Address, sector abi.SectorNumber) []abi.DealID {
+	provider, err := address.IDFromAddress(maddr)
+	if err != nil {
+		return nil
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.sectors[sectorKey{provider: abi.ActorID(provider), sector: sector}]
+}
+
+func (c *Cache) Get(ctx context.Context, id abi.DealID) (*api.MarketDeal, error) {
+	c.lk.Lock()
+	e, ok := c.entries[id]
+	if !ok {
+		if c.bulk {
+			c.lk.Unlock()
+			return nil, fmt.Errorf("deal %d not found in market state", id)
+		}
+		e = &entry{done: make(chan struct{})}
+		c.entries[id] = e
+		c.lk.Unlock()
+
+		e.deal, e.err = c.api.StateMarketStorageDeal(ctx, id, c.tsk)
+		if e.err != nil {
+			c.lk.Lock()
+			delete(c.entries, id)
+			c.lk.Unlock()
+		}
+		close(e.done)
+		return e.deal, e.err
+	}
+	c.lk.Unlock()
+
+	select {
+	case <-e.done:
+		return e.deal, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Prefetch resolves ids with at most workers concurrent lookups. Errors are
+// dropped here; the caller sees them again on its own Get.
+func (c *Cache) Prefetch(ctx context.Context, ids []abi.DealID, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ch := make(chan abi.DealID)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ch {
+				_, _ = c.Get(ctx, id)
+			}
+		}()
+	}
+
+loop:
+	for _, id := range ids {
+		select {
+		case ch <- id:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+}
@@ -0,0 +1,220 @@
+package dealcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+
+	"check-sector-info/lotustest"
+)
+
+// fakeAPI answers StateMarketStorageDeal, blocking every call until release
+// is closed when it is set.
+type fakeAPI struct {
+	DealAPI
+	release chan struct{}
+	fail    map[abi.DealID]int
+
+	lk    sync.Mutex
+	calls map[abi.DealID]int
+}
+
+func (f *fakeAPI) StateMarketStorageDeal(_ context.Context, id abi.DealID, _ types.TipSetKey) (*api.MarketDeal, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[abi.DealID]int)
+	}
+	f.calls[id]++
+	if f.fail[id] >= f.calls[id] {
+		return nil, fmt.Errorf("deal %d: connection reset", id)
+	}
+	return &api.MarketDeal{Proposal: market.DealProposal{PieceSize: abi.PaddedPieceSize(id)}}, nil
+}
+
+func (f *fakeAPI) called(id abi.DealID) int {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.calls[id]
+}
+
+func TestGetConcurrent(t *testing.T) {
+	f := &fakeAPI{release: make(chan struct{})}
+	c := New(f, types.EmptyTSK)
+
+	var wg sync.WaitGroup
+	var ok atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if d, err := c.Get(context.Background(), 7); err == nil && d.Proposal.PieceSize == 7 {
+				ok.Add(1)
+			}
+		}()
+	}
+	close(f.release)
+	wg.Wait()
+
+	if ok.Load() != 10 || f.called(7) != 1 {
+		t.Errorf("%d of 10 lookups served by %d calls", ok.Load(), f.called(7))
+	}
+}
+
+func TestGetErrorNotCached(t *testing.T) {
+	f := &fakeAPI{fail: map[abi.DealID]int{7: 1}}
+	c := New(f, types.EmptyTSK)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, 7); err == nil {
+		t.Fatal("first lookup succeeded")
+	}
+	if d, err := c.Get(ctx, 7); err != nil || d.Proposal.PieceSize != 7 {
+		t.Fatalf("retry = %+v, %v", d, err)
+	}
+	if _, err := c.Get(ctx, 7); err != nil || f.called(7) != 2 {
+		t.Errorf("%d calls, %v", f.called(7), err)
+	}
+}
+
+func TestGetCanceled(t *testing.T) {
+	f := &fakeAPI{release: make(chan struct{})}
+	c := New(f, types.EmptyTSK)
+
+	go c.Get(context.Background(), 7)
+	// wait until the first lookup owns the entry
+	for {
+		c.lk.Lock()
+		_, ok := c.entries[7]
+		c.lk.Unlock()
+		if ok {
+			break
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, 7); !errors.Is(err, context.Canceled) {
+		t.Errorf("waiting lookup = %v", err)
+	}
+	close(f.release)
+}
+
+func TestPrefetch(t *testing.T) {
+	f := &fakeAPI{fail: map[abi.DealID]int{3: 1}}
+	c := New(f, types.EmptyTSK)
+	ctx := context.Background()
+
+	c.Prefetch(ctx, []abi.DealID{1, 2, 3, 2, 1, 4, 4}, 3)
+	for id := abi.DealID(1); id <= 4; id++ {
+		if f.called(id) != 1 {
+			t.Errorf("deal %d fetched %d times", id, f.called(id))
+		}
+	}
+	// the failed lookup is tried again, the others are served from memory
+	for id := abi.DealID(1); id <= 4; id++ {
+		if _, err := c.Get(ctx, id); err != nil {
+			t.Errorf("deal %d: %s", id, err)
+		}
+	}
+	if f.called(1) != 1 || f.called(3) != 2 {
+		t.Errorf("calls %v", f.calls)
+	}
+}
+
+// TestLoad compares the bulk path with the per deal and per miner lookups
+// against the same chain.
+func TestLoad(t *testing.T) {
+	m1, _ := address.NewIDAddress(1000)
+	m2, _ := address.NewIDAddress(2000)
+	deal := func(provider address.Address, sector abi.SectorNumber, start abi.ChainEpoch) *api.MarketDeal {
+		return &api.MarketDeal{
+			Proposal: market.DealProposal{Provider: provider, StartEpoch: 100, EndEpoch: 200},
+			State:    api.MarketDealState{SectorNumber: sector, SectorStartEpoch: start, LastUpdatedEpoch: -1, SlashEpoch: -1},
+		}
+	}
+	srv := lotustest.NewServer(t, &lotustest.Chain{
+		Head: 1000,
+		Miners: map[address.Address]*lotustest.Miner{
+			m1: {Sectors: []*miner.SectorOnChainInfo{lotustest.Sector(1, 100, 200, lotustest.FIL(1))}},
+			m2: {},
+		},
+		Deals: map[abi.DealID]*api.MarketDeal{
+			10: deal(m1, 1, 100),
+			11: deal(m1, 1, 100),
+			12: deal(m1, 2, 100),
+			13: deal(m2, 1, 100),
+			// published, not yet in a sector
+			14: deal(m1, 3, -1),
+		},
+	})
+	ctx := context.Background()
+	node, closer, err := client.NewFullNodeRPCV1(ctx, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+
+	bulk := New(node, types.EmptyTSK)
+	if err := bulk.LoadAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	serial := New(node, types.EmptyTSK)
+	for _, maddr := range []address.Address{m1, m2} {
+		if err := serial.LoadSectors(ctx, maddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		maddr  address.Address
+		sector abi.SectorNumber
+		want   []abi.DealID
+	}{
+		{m1, 1, []abi.DealID{10, 11}},
+		{m1, 2, []abi.DealID{12}},
+		{m1, 3, nil},
+		{m2, 1, []abi.DealID{13}},
+		{m2, 2, nil},
+	} {
+		b, s := bulk.SectorDeals(c.maddr, c.sector), serial.SectorDeals(c.maddr, c.sector)
+		if !reflect.DeepEqual(b, c.want) || !reflect.DeepEqual(s, c.want) {
+			t.Errorf("%s sector %d: bulk %v, serial %v, want %v", c.maddr, c.sector, b, s, c.want)
+		}
+	}
+
+	for id := abi.DealID(10); id <= 14; id++ {
+		b, err := bulk.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := serial.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(b, s) {
+			t.Errorf("deal %d: bulk %+v, serial %+v", id, b, s)
+		}
+	}
+	if srv.Calls("StateMarketStorageDeal") != 5 || srv.Calls("StateMarketDeals") != 1 {
+		t.Errorf("%d deal lookups, %d bulk loads", srv.Calls("StateMarketStorageDeal"), srv.Calls("StateMarketDeals"))
+	}
+	// after LoadAll an unknown deal is not looked up
+	if _, err := bulk.Get(ctx, 99); err == nil || srv.Calls("StateMarketStorageDeal") != 5 {
+		t.Errorf("unknown deal = %v, %d lookups", err, srv.Calls("StateMarketStorageDeal"))
+	}
+}
@@ -0,0 +1,99 @@
+package dealcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	market16 "github.com/filecoin-project/go-state-types/builtin/v16/market"
+	"github.com/filecoin-project/go-state-types/builtin/v16/util/adt"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// LoadSectors restores the deal ids of every sector of maddr from the
+// ProviderSectors map of the market actor, the sector to deal index the
+// market keeps since nv22. Unlike LoadAll it only reads the part of the
+// market state that belongs to maddr. The state is decoded with the v16
+// layout, which has not changed since ProviderSectors was introduced.
+func (c *Cache) LoadSectors(ctx context.Context, maddr address.Address) error {
+	provider, err := address.IDFromAddress(maddr)
+	if err != nil {
+		return err
+	}
+	act, err := c.api.StateGetActor(ctx, builtin.StorageMarketActorAddr, c.tsk)
+	if err != nil {
+		return fmt.Errorf("get market actor: %w", err)
+	}
+
+	store := adt.WrapStore(ctx, objStore{c.api})
+	var st market16.State
+	if err := store.Get(ctx, act.Head, &st); err != nil {
+		return fmt.Errorf("decode market state: %w", err)
+	}
+	providers, err := adt.AsMap(store, st.ProviderSectors, market16.ProviderSectorsHamtBitwidth)
+	if err != nil {
+		return fmt.Errorf("load provider sectors: %w", err)
+	}
+
+	sectors := make(map[sectorKey][]abi.DealID)
+	var root cbg.CborCid
+	found, err := providers.Get(abi.UIntKey(provider), &root)
+	if err != nil {
+		return fmt.Errorf("load provider sectors of %s: %w", maddr, err)
+	}
+	if found {
+		m, err := adt.AsMap(store, cid.Cid(root), market16.ProviderSectorsHamtBitwidth)
+		if err != nil {
+			return fmt.Errorf("load provider sectors of %s: %w", maddr, err)
+		}
+		var ids market16.SectorDealIDs
+		err = m.ForEach(&ids, func(k string) error {
+			n, err := abi.ParseUIntKey(k)
+			if err != nil {
+				return err
+			}
+			key := sectorKey{provider: abi.ActorID(provider), sector: abi.SectorNumber(n)}
+			sectors[key] = append([]abi.DealID(nil), ids...)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("read provider sectors of %s: %w", maddr, err)
+		}
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if c.sectors == nil {
+		c.sectors = make(map[sectorKey][]abi.DealID)
+	}
+	for k, ids := range sectors {
+		c.sectors[k] = ids
+	}
+	return nil
+}
+
+// objStore reads state objects through ChainReadObj.
+type objStore struct {
+	api DealAPI
+}
+
+func (s objStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	u, ok := out.(cbg.CBORUnmarshaler)
+	if !ok {
+		return fmt.Errorf("cannot decode %T", out)
+	}
+	b, err := s.api.ChainReadObj(ctx, c)
+	if err != nil {
+		return err
+	}
+	return u.UnmarshalCBOR(bytes.NewReader(b))
+}
+
+func (objStore) Put(context.Context, interface{}) (cid.Cid, error) {
+	return cid.Undef, errors.New("market state is read only")
+}
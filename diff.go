@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/lotusclient"
+	"check-sector-info/output"
+	"check-sector-info/sectordiff"
+	"check-sector-info/sectorstatus"
+	timeToHeight "check-sector-info/time-height"
+)
+
+type DiffReport struct {
+	Cluster string                  `json:"cluster,omitempty"`
+	Miner   string                  `json:"miner"`
+	From    timeToHeight.Resolution `json:"from"`
+	To      timeToHeight.Resolution `json:"to"`
+	sectordiff.Diff
+}
+
+// runDiff compares the live sectors at -from with those at to, the chain
+// head when -d is not given.
+func runDiff(ctx context.Context, delegate lotusclient.Node, t target, to *timeToHeight.Resolution, f output.Format, notice io.Writer) {
+	fromAt, err := resolvePoint(ctx, delegate, *from)
+	if err != nil {
+		log.Fatalf("invalid -from %q,err:%s", *from, err)
+	}
+	fmt.Fprintf(notice, "起始时间 %s 使用 %s\n", *from, fromAt)
+
+	if to == nil {
+		head, err := delegate.ChainHead(ctx)
+		if err != nil {
+			log.Fatalf("failed to get chain head,err:%s", err)
+		}
+		r := timeToHeight.At(head)
+		to = &r
+	}
+	if fromAt.Height >= to.Height {
+		log.Fatalf("-from height %d is not before the end height %d", fromAt.Height, to.Height)
+	}
+
+	snapshot := func(r *timeToHeight.Resolution) sectordiff.Snapshot {
+		s, err := sectorstatus.Load(ctx, delegate, t.addr, r.Tipset)
+		if err != nil {
+			log.Fatalf("failed to get miner sectors at height %d,err:%s", r.Height, err)
+		}
+		return sectordiff.Snapshot{Height: r.Height, Sectors: s.Live(), Status: s.Status}
+	}
+
+	r := DiffReport{
+		Cluster: t.Cluster,
+		Miner:   t.addr.String(),
+		From:    *fromAt,
+		To:      *to,
+		Diff:    sectordiff.Compare(snapshot(fromAt), snapshot(to)),
+	}
+	if !*detail {
+		r.Changes = nil
+	}
+	if err := r.Write(os.Stdout, f); err != nil {
+		log.Fatalf("write report failed,err:%s", err)
+	}
+}
+
+func (r DiffReport) Write(w io.Writer, f output.Format) error {
+	switch f {
+	case output.JSON:
+		return output.WriteJSON(w, r)
+	case output.NDJSON:
+		for _, c := range r.Changes {
+			if err := output.WriteNDJSON(w, "change", c); err != nil {
+				return err
+			}
+		}
+		for _, s := range r.Summary {
+			if err := output.WriteNDJSON(w, "summary", s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case output.CSV:
+		return r.writeCSV(w)
+	default:
+		r.writeText(w)
+		return nil
+	}
+}
+
+func (r DiffReport) writeText(w io.Writer) {
+	for _, c := range r.Changes {
+		fmt.Fprintf(w, "%s sector:%d,Expiration:%d -> %d,InitialPledge:%s -> %s,%s\n",
+			c.Category, c.Sector, c.FromExpiration, c.ToExpiration, c.FromPledge, c.ToPledge, pledgeText(c.Category, c.Pledge, c.StatusPledge))
+	}
+
+	fmt.Fprintf(w, "==============变动总览 %d(%s) -> %d(%s)===============\n",
+		r.From.Height, r.From.Timestamp.Format("2006-01-02 15:04:05"),
+		r.To.Height, r.To.Timestamp.Format("2006-01-02 15:04:05"))
+	for _, s := range r.Summary {
+		fmt.Fprintf(w, "%s sector \t%d个，%s\n", s.Category, s.Count, pledgeText(s.Category, s.Pledge, s.StatusPledge))
+	}
+}
+
+// pledgeText shows the pledge a change moved, or for a status change the
+// pledge at stake, which stays locked.
+func pledgeText(c sectordiff.Category, pledge, statusPledge decimal.Decimal) string {
+	if c == sectordiff.Faulty || c == sectordiff.Recovered {
+		return fmt.Sprintf("涉及质押：%s Fil", statusPledge.StringFixed(4))
+	}
+	return fmt.Sprintf("质押变动：%s Fil", pledge.StringFixed(4))
+}
+
+func (r DiffReport) writeCSV(w io.Writer) error {
+	var tables []output.Table
+
+	if len(r.Changes) != 0 {
+		t := output.Table{Header: []string{"category", "sector", "from_expiration", "to_expiration", "from_pledge", "to_pledge", "pledge", "status_pledge"}}
+		for _, c := range r.Changes {
+			t.Rows = append(t.Rows, []string{
+				string(c.Category),
+				c.Sector.String(),
+				c.FromExpiration.String(),
+				c.ToExpiration.String(),
+				c.FromPledge.String(),
+				c.ToPledge.String(),
+				c.Pledge.String(),
+				c.StatusPledge.String(),
+			})
+		}
+		tables = append(tables, t)
+	}
+
+	summary := output.Table{Header: []string{"category", "count", "pledge", "status_pledge", "from_height", "to_height"}}
+	for _, s := range r.Summary {
+		summary.Rows = append(summary.Rows, []string{
+			string(s.Category),
+			strconv.Itoa(s.Count),
+			s.Pledge.String(),
+			s.StatusPledge.String(),
+			r.From.Height.String(),
+			r.To.Height.String(),
+		})
+	}
+	tables = append(tables, summary)
+
+	return output.WriteCSV(w, tables...)
+}
@@ -0,0 +1,172 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/filecoin-project/lotus/chain/actors/policy"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type PolicyAPI interface {
+	ChainHead(context.Context) (*types.TipSet, error)
+	ChainGetTipSet(context.Context, types.TipSetKey) (*types.TipSet, error)
+	StateNetworkVersion(context.Context, types.TipSetKey) (network.Version, error)
+}
+
+type ClaimAPI interface {
+	StateGetClaims(context.Context, address.Address, types.TipSetKey) (map[verifreg.ClaimId]verifreg.Claim, error)
+}
+
+// Policy holds the extension limits of the network version at one tipset.
+type Policy struct {
+	NetworkVersion network.Version
+	Epoch          abi.ChainEpoch
+	MaxExtension   abi.ChainEpoch
+	MinExpiration  abi.ChainEpoch
+}
+
+func LoadPolicy(ctx context.Context, api PolicyAPI, tsk types.TipSetKey) (Policy, error) {
+	var ts *types.TipSet
+	var err error
+	if tsk == types.EmptyTSK {
+		ts, err = api.ChainHead(ctx)
+	} else {
+		ts, err = api.ChainGetTipSet(ctx, tsk)
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("get tipset: %w", err)
+	}
+
+	nv, err := api.StateNetworkVersion(ctx, ts.Key())
+	if err != nil {
+		return Policy{}, fmt.Errorf("get network version: %w", err)
+	}
+
+	return NewPolicy(nv, ts.Height())
+}
+
+func NewPolicy(nv network.Version, epoch abi.ChainEpoch) (Policy, error) {
+	maxExtension, err := policy.GetMaxSectorExpirationExtension(nv)
+	if err != nil {
+		return Policy{}, fmt.Errorf("get max sector expiration extension for network version %d: %w", nv, err)
+	}
+
+	return Policy{
+		NetworkVersion: nv,
+		Epoch:          epoch,
+		MaxExtension:   maxExtension,
+		MinExpiration:  policy.GetMinSectorExpiration(),
+	}, nil
+}
+
+type Claim struct {
+	ID verifreg.ClaimId
+	verifreg.Claim
+}
+
+// ClaimsBySector indexes the claims of one provider by sector number.
+func ClaimsBySector(claims map[verifreg.ClaimId]verifreg.Claim) map[abi.SectorNumber][]Claim {
+	bySector := make(map[abi.SectorNumber][]Claim)
+	for id, c := range claims {
+		bySector[c.Sector] = append(bySector[c.Sector], Claim{ID: id, Claim: c})
+	}
+	for _, cs := range bySector {
+		sort.Slice(cs, func(i, j int) bool { return cs[i].ID < cs[j].ID })
+	}
+	return bySector
+}
+
+func LoadClaims(ctx context.Context, api ClaimAPI, maddr address.Address, tsk types.TipSetKey) (map[abi.SectorNumber][]Claim, error) {
+	claims, err := api.StateGetClaims(ctx, maddr, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get claims: %w", err)
+	}
+	return ClaimsBySector(claims), nil
+}
+
+type Eligibility struct {
+	Extendable bool `json:"extendable"`
+	// MaxExpiration is the latest expiration the sector can be extended to
+	// without losing any claim, zero when it cannot be extended.
+	MaxExpiration abi.ChainEpoch `json:"max_expiration"`
+	Reason        string         `json:"reason,omitempty"`
+	// DealEnd is the latest end epoch of the sector's builtin market deals.
+	DealEnd abi.ChainEpoch `json:"deal_end,omitempty"`
+}
+
+// Evaluate decides whether a sector can be extended under the policy. The
+// new expiration is capped by the sector's max lifetime, the network's max
+// extension from the current epoch and TermStart+TermMax of each claim, and
+// the sector has to live at least the min sector expiration from its
+// activation, as the miner actor checks. Builtin market deals end before
+// their sector expires, so any extension covers them.
+func (p Policy) Evaluate(s *miner.SectorOnChainInfo, claims []Claim, deals []*api.MarketDeal) Eligibility {
+	var e Eligibility
+	var verifiedDeals bool
+	for _, d := range deals {
+		if d.Proposal.EndEpoch > e.DealEnd {
+			e.DealEnd = d.Proposal.EndEpoch
+		}
+		verifiedDeals = verifiedDeals || d.Proposal.VerifiedDeal
+	}
+
+	if s.Expiration <= p.Epoch {
+		e.Reason = "sector already expired"
+		return e
+	}
+
+	// verified data from before claims existed can't be carried over to a
+	// new expiration, the actor rejects such extensions
+	if len(claims) == 0 && (verifiedDeals || !s.VerifiedDealWeight.IsZero()) {
+		e.Reason = "verified deals without claims"
+		return e
+	}
+
+	maxExp := s.Activation + policy.GetSectorMaxLifetime(s.SealProof, p.NetworkVersion)
+	reason := "max sector lifetime reached"
+	if ext := p.Epoch + p.MaxExtension; ext < maxExp {
+		maxExp = ext
+		reason = "max extension from current epoch reached"
+	}
+	for _, c := range claims {
+		if termEnd := c.TermStart + c.TermMax; termEnd < maxExp {
+			maxExp = termEnd
+			reason = fmt.Sprintf("claim %d term max reached", c.ID)
+		}
+	}
+
+	if maxExp <= s.Expiration {
+		e.Reason = reason
+		return e
+	}
+	if maxExp < s.Activation+p.MinExpiration {
+		e.Reason = "new expiration below min sector expiration"
+		return e
+	}
+
+	e.Extendable = true
+	e.MaxExpiration = maxExp
+	return e
+}
+
+// NewExpiration caps target to the max expiration of an extendable sector
+// and checks the result against the same bounds as Evaluate, it returns the
+// reason when the sector cannot be extended to it.
+func (p Policy) NewExpiration(s *miner.SectorOnChainInfo, e Eligibility, target abi.ChainEpoch) (abi.ChainEpoch, string) {
+	newExp := min(target, e.MaxExpiration)
+	switch {
+	case newExp <= s.Expiration:
+		return 0, "already expires after target"
+	case newExp < s.Activation+p.MinExpiration:
+		return 0, "new expiration below min sector expiration"
+	}
+	return newExp, ""
+}
@@ -0,0 +1,138 @@
+package extension
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/filecoin-project/lotus/chain/actors/policy"
+)
+
+func TestEvaluate(t *testing.T) {
+	const epoch = abi.ChainEpoch(4_000_000)
+	pol, err := NewPolicy(network.Version25, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := abi.RegisteredSealProof_StackedDrg32GiBV1_1
+	lifetime := policy.GetSectorMaxLifetime(proof, pol.NetworkVersion)
+	// the cases below assume min expiration < max extension < max lifetime
+	if pol.MinExpiration >= pol.MaxExtension || pol.MaxExtension >= lifetime {
+		t.Fatalf("nv25 policy %+v, max lifetime %d", pol, lifetime)
+	}
+
+	sector := func(activation, expiration abi.ChainEpoch, verified bool) *miner.SectorOnChainInfo {
+		s := &miner.SectorOnChainInfo{
+			SealProof:          proof,
+			Activation:         activation,
+			Expiration:         expiration,
+			DealWeight:         big.Zero(),
+			VerifiedDealWeight: big.Zero(),
+		}
+		if verified {
+			s.VerifiedDealWeight = big.NewInt(1 << 40)
+		}
+		return s
+	}
+	deal := func(end abi.ChainEpoch, verified bool) []*api.MarketDeal {
+		return []*api.MarketDeal{{Proposal: market.DealProposal{StartEpoch: epoch - 100, EndEpoch: end, VerifiedDeal: verified}}}
+	}
+	claim := func(termStart, termMax abi.ChainEpoch) []Claim {
+		return []Claim{{ID: 7, Claim: verifreg.Claim{TermStart: termStart, TermMax: termMax}}}
+	}
+
+	for _, c := range []struct {
+		name   string
+		sector *miner.SectorOnChainInfo
+		claims []Claim
+		deals  []*api.MarketDeal
+		want   Eligibility
+	}{{
+		name:   "extendable to max extension",
+		sector: sector(epoch-100, epoch+1000, false),
+		deals:  deal(epoch+1000, false),
+		want:   Eligibility{Extendable: true, MaxExpiration: epoch + pol.MaxExtension, DealEnd: epoch + 1000},
+	}, {
+		name:   "expired",
+		sector: sector(epoch-100, epoch, false),
+		want:   Eligibility{Reason: "sector already expired"},
+	}, {
+		name:   "verified weight without claims",
+		sector: sector(epoch-100, epoch+1000, true),
+		want:   Eligibility{Reason: "verified deals without claims"},
+	}, {
+		name:   "verified market deal without claims",
+		sector: sector(epoch-100, epoch+1000, false),
+		deals:  deal(epoch+1000, true),
+		want:   Eligibility{Reason: "verified deals without claims", DealEnd: epoch + 1000},
+	}, {
+		name:   "max lifetime",
+		sector: sector(epoch+100-lifetime, epoch+100, false),
+		want:   Eligibility{Reason: "max sector lifetime reached"},
+	}, {
+		name:   "max extension",
+		sector: sector(epoch-100, epoch+pol.MaxExtension, false),
+		want:   Eligibility{Reason: "max extension from current epoch reached"},
+	}, {
+		name:   "claim term max",
+		sector: sector(epoch-100, epoch+1000, true),
+		claims: claim(epoch-100, 1100),
+		want:   Eligibility{Reason: "claim 7 term max reached"},
+	}, {
+		name:   "extendable to claim term max",
+		sector: sector(epoch-100, epoch+1000, true),
+		claims: claim(epoch-100, pol.MinExpiration+1100),
+		want:   Eligibility{Extendable: true, MaxExpiration: epoch + pol.MinExpiration + 1000},
+	}, {
+		name:   "below min expiration",
+		sector: sector(epoch-100, epoch+1000, true),
+		claims: claim(epoch-100, 2100),
+		want:   Eligibility{Reason: "new expiration below min sector expiration"},
+	}, {
+		// the min expiration counts from activation, not from the current epoch
+		name:   "old sector below min expiration from now",
+		sector: sector(epoch-pol.MinExpiration, epoch+100, true),
+		claims: claim(epoch-pol.MinExpiration, pol.MinExpiration+500),
+		want:   Eligibility{Extendable: true, MaxExpiration: epoch + 500},
+	}} {
+		got := pol.Evaluate(c.sector, c.claims, c.deals)
+		if got != c.want {
+			t.Errorf("%s: %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNewExpiration(t *testing.T) {
+	const epoch = abi.ChainEpoch(4_000_000)
+	pol, err := NewPolicy(network.Version25, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	young := &miner.SectorOnChainInfo{Activation: epoch - 100, Expiration: epoch + 1000}
+	old := &miner.SectorOnChainInfo{Activation: epoch - pol.MinExpiration, Expiration: epoch + 1000}
+	e := Eligibility{Extendable: true, MaxExpiration: epoch + pol.MaxExtension}
+
+	for _, c := range []struct {
+		name   string
+		sector *miner.SectorOnChainInfo
+		target abi.ChainEpoch
+		want   abi.ChainEpoch
+		reason string
+	}{
+		{"target", young, epoch + pol.MinExpiration, epoch + pol.MinExpiration, ""},
+		{"capped to max expiration", young, epoch + pol.MaxExtension + 1000, epoch + pol.MaxExtension, ""},
+		{"before current expiration", young, epoch + 1000, 0, "already expires after target"},
+		{"target below min expiration", young, epoch + 2000, 0, "new expiration below min sector expiration"},
+		{"old sector", old, epoch + 2000, epoch + 2000, ""},
+	} {
+		got, reason := pol.NewExpiration(c.sector, e, c.target)
+		if got != c.want || reason != c.reason {
+			t.Errorf("%s: %d %q, want %d %q", c.name, got, reason, c.want, c.reason)
+		}
+	}
+}
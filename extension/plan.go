@@ -0,0 +1,178 @@
+package extension
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	miner16 "github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	verifreg16 "github.com/filecoin-project/go-state-types/builtin/v16/verifreg"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/policy"
+	"github.com/shopspring/decimal"
+)
+
+type Location struct {
+	Deadline  uint64 `json:"deadline"`
+	Partition uint64 `json:"partition"`
+}
+
+type Limits struct {
+	MaxSectors      int `json:"max_sectors"`
+	MaxDeclarations int `json:"max_declarations"`
+}
+
+// Limits returns the per message limits of ExtendSectorExpiration2.
+func (p Policy) Limits() (Limits, error) {
+	maxSectors, err := policy.GetAddressedSectorsMax(p.NetworkVersion)
+	if err != nil {
+		return Limits{}, fmt.Errorf("get addressed sectors max: %w", err)
+	}
+	maxDecls, err := policy.GetDeclarationsMax(p.NetworkVersion)
+	if err != nil {
+		return Limits{}, fmt.Errorf("get declarations max: %w", err)
+	}
+	return Limits{MaxSectors: maxSectors, MaxDeclarations: maxDecls}, nil
+}
+
+type Candidate struct {
+	Sector        *miner.SectorOnChainInfo
+	Location      Location
+	NewExpiration abi.ChainEpoch
+	Claims        []Claim
+}
+
+// PledgeDays is the sector's initial pledge in FIL multiplied by the number
+// of days the extension adds.
+func (c Candidate) PledgeDays() decimal.Decimal {
+	if c.Sector.InitialPledge.Int == nil {
+		return decimal.Zero
+	}
+	days := decimal.NewFromInt(int64(c.NewExpiration - c.Sector.Expiration)).Div(decimal.NewFromInt(builtin.EpochsInDay))
+	return decimal.NewFromBigInt(c.Sector.InitialPledge.Int, -18).Mul(days)
+}
+
+type Batch struct {
+	Params     miner16.ExtendSectorExpiration2Params `json:"params"`
+	ParamsHex  string                                `json:"params_hex"`
+	Sectors    int                                   `json:"sectors"`
+	PledgeDays decimal.Decimal                       `json:"pledge_days"`
+}
+
+type declKey struct {
+	Location
+	expiration abi.ChainEpoch
+}
+
+// BuildBatches groups candidates into one declaration per deadline,
+// partition and new expiration and packs the declarations into messages
+// that stay within the limits. Declarations larger than the sector limit
+// are split.
+func BuildBatches(cands []Candidate, limits Limits) ([]Batch, error) {
+	if limits.MaxSectors < 1 || limits.MaxDeclarations < 1 {
+		return nil, fmt.Errorf("invalid limits %+v", limits)
+	}
+
+	groups := make(map[declKey][]Candidate)
+	var keys []declKey
+	for _, c := range cands {
+		k := declKey{Location: c.Location, expiration: c.NewExpiration}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], c)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Deadline != keys[j].Deadline {
+			return keys[i].Deadline < keys[j].Deadline
+		}
+		if keys[i].Partition != keys[j].Partition {
+			return keys[i].Partition < keys[j].Partition
+		}
+		return keys[i].expiration < keys[j].expiration
+	})
+
+	var batches []Batch
+	var cur []Candidate
+	var curDecls [][]Candidate
+	flush := func() error {
+		if len(curDecls) == 0 {
+			return nil
+		}
+		b, err := newBatch(curDecls)
+		if err != nil {
+			return err
+		}
+		batches = append(batches, b)
+		cur, curDecls = nil, nil
+		return nil
+	}
+
+	for _, k := range keys {
+		group := groups[k]
+		sort.Slice(group, func(i, j int) bool { return group[i].Sector.SectorNumber < group[j].Sector.SectorNumber })
+
+		for len(group) > 0 {
+			if len(cur) == limits.MaxSectors || len(curDecls) == limits.MaxDeclarations {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+
+			n := min(len(group), limits.MaxSectors-len(cur))
+			cur = append(cur, group[:n]...)
+			curDecls = append(curDecls, group[:n])
+			group = group[n:]
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+func newBatch(decls [][]Candidate) (Batch, error) {
+	b := Batch{PledgeDays: decimal.Zero}
+	for _, decl := range decls {
+		ext := miner16.ExpirationExtension2{
+			Deadline:          decl[0].Location.Deadline,
+			Partition:         decl[0].Location.Partition,
+			NewExpiration:     decl[0].NewExpiration,
+			SectorsWithClaims: []miner16.SectorClaim{},
+		}
+
+		var plain []uint64
+		for _, c := range decl {
+			b.Sectors++
+			b.PledgeDays = b.PledgeDays.Add(c.PledgeDays())
+
+			if len(c.Claims) == 0 {
+				plain = append(plain, uint64(c.Sector.SectorNumber))
+				continue
+			}
+			sc := miner16.SectorClaim{
+				SectorNumber:   c.Sector.SectorNumber,
+				MaintainClaims: make([]verifreg16.ClaimId, 0, len(c.Claims)),
+				DropClaims:     []verifreg16.ClaimId{},
+			}
+			for _, claim := range c.Claims {
+				sc.MaintainClaims = append(sc.MaintainClaims, verifreg16.ClaimId(claim.ID))
+			}
+			ext.SectorsWithClaims = append(ext.SectorsWithClaims, sc)
+		}
+		ext.Sectors = bitfield.NewFromSet(plain)
+
+		b.Params.Extensions = append(b.Params.Extensions, ext)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Params.MarshalCBOR(&buf); err != nil {
+		return Batch{}, fmt.Errorf("serialize params: %w", err)
+	}
+	b.ParamsHex = hex.EncodeToString(buf.Bytes())
+	return b, nil
+}
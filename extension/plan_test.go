@@ -0,0 +1,174 @@
+package extension
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	miner16 "github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/shopspring/decimal"
+)
+
+const expiration = abi.ChainEpoch(4_000_000)
+
+// cand extends sector n of dl/part by days, the sector pledges 1 FIL.
+func cand(n abi.SectorNumber, dl, part uint64, days int, claims ...verifreg.ClaimId) Candidate {
+	c := Candidate{
+		Sector: &miner.SectorOnChainInfo{
+			SectorNumber:  n,
+			Expiration:    expiration,
+			InitialPledge: big.Mul(big.NewInt(1), big.NewInt(1e18)),
+		},
+		Location:      Location{Deadline: dl, Partition: part},
+		NewExpiration: expiration + abi.ChainEpoch(days)*builtin.EpochsInDay,
+	}
+	for _, id := range claims {
+		c.Claims = append(c.Claims, Claim{ID: id})
+	}
+	return c
+}
+
+// describe prints each declaration as deadline/partition+days, the plain
+// sectors and the sectors with the claims they keep.
+func describe(t *testing.T, p miner16.ExtendSectorExpiration2Params) string {
+	t.Helper()
+	var decls []string
+	for _, ext := range p.Extensions {
+		plain, err := ext.Sectors.All(1 << 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := fmt.Sprintf("%d/%d+%d %v", ext.Deadline, ext.Partition, (ext.NewExpiration-expiration)/builtin.EpochsInDay, plain)
+		for _, sc := range ext.SectorsWithClaims {
+			s += fmt.Sprintf(" %d:%v-%v", sc.SectorNumber, sc.MaintainClaims, sc.DropClaims)
+		}
+		decls = append(decls, s)
+	}
+	return strings.Join(decls, ", ")
+}
+
+func TestBuildBatches(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		cands  []Candidate
+		limits Limits
+		want   []string
+	}{{
+		name:   "one declaration",
+		cands:  []Candidate{cand(3, 0, 0, 180), cand(1, 0, 0, 180), cand(2, 0, 0, 180)},
+		limits: Limits{MaxSectors: 10, MaxDeclarations: 10},
+		want:   []string{"0/0+180 [1 2 3]"},
+	}, {
+		name:   "declaration per partition and expiration",
+		cands:  []Candidate{cand(4, 1, 0, 180), cand(1, 0, 1, 180), cand(2, 0, 0, 360), cand(3, 0, 0, 180)},
+		limits: Limits{MaxSectors: 10, MaxDeclarations: 10},
+		want:   []string{"0/0+180 [3], 0/0+360 [2], 0/1+180 [1], 1/0+180 [4]"},
+	}, {
+		name:   "addressed sectors max splits a declaration",
+		cands:  []Candidate{cand(1, 0, 0, 180), cand(2, 0, 0, 180), cand(3, 0, 0, 180), cand(4, 0, 0, 180), cand(5, 0, 0, 180)},
+		limits: Limits{MaxSectors: 2, MaxDeclarations: 10},
+		want:   []string{"0/0+180 [1 2]", "0/0+180 [3 4]", "0/0+180 [5]"},
+	}, {
+		name:   "addressed sectors max across declarations",
+		cands:  []Candidate{cand(1, 0, 0, 180), cand(2, 0, 0, 180), cand(3, 0, 0, 180), cand(4, 1, 0, 180), cand(5, 1, 0, 180)},
+		limits: Limits{MaxSectors: 4, MaxDeclarations: 10},
+		want:   []string{"0/0+180 [1 2 3], 1/0+180 [4]", "1/0+180 [5]"},
+	}, {
+		name:   "declarations max",
+		cands:  []Candidate{cand(1, 0, 0, 180), cand(2, 1, 0, 180), cand(3, 2, 0, 180)},
+		limits: Limits{MaxSectors: 10, MaxDeclarations: 2},
+		want:   []string{"0/0+180 [1], 1/0+180 [2]", "2/0+180 [3]"},
+	}, {
+		name:   "sectors with claims",
+		cands:  []Candidate{cand(1, 0, 0, 180), cand(2, 0, 0, 180, 8, 7), cand(3, 0, 0, 180, 9)},
+		limits: Limits{MaxSectors: 10, MaxDeclarations: 10},
+		want:   []string{"0/0+180 [1] 2:[8 7]-[] 3:[9]-[]"},
+	}, {
+		name:   "only sectors with claims",
+		cands:  []Candidate{cand(2, 0, 0, 180, 7)},
+		limits: Limits{MaxSectors: 10, MaxDeclarations: 10},
+		want:   []string{"0/0+180 [] 2:[7]-[]"},
+	}, {
+		name:   "nothing to extend",
+		limits: Limits{MaxSectors: 10, MaxDeclarations: 10},
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			batches, err := BuildBatches(c.cands, c.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			sectors := 0
+			pledgeDays := decimal.Zero
+			for _, b := range batches {
+				got = append(got, describe(t, b.Params))
+				sectors += b.Sectors
+				pledgeDays = pledgeDays.Add(b.PledgeDays)
+			}
+			if strings.Join(got, " | ") != strings.Join(c.want, " | ") {
+				t.Errorf("batches\n%s\nwant\n%s", strings.Join(got, " | "), strings.Join(c.want, " | "))
+			}
+			// every sector pledges 1 FIL
+			var days int64
+			for _, cd := range c.cands {
+				days += int64((cd.NewExpiration - expiration) / builtin.EpochsInDay)
+			}
+			if sectors != len(c.cands) || !pledgeDays.Equal(decimal.NewFromInt(days)) {
+				t.Errorf("%d sectors and %s pledge days in batches, want %d and %d", sectors, pledgeDays, len(c.cands), days)
+			}
+		})
+	}
+
+	for _, limits := range []Limits{{MaxSectors: 0, MaxDeclarations: 1}, {MaxSectors: 1, MaxDeclarations: 0}} {
+		if _, err := BuildBatches([]Candidate{cand(1, 0, 0, 180)}, limits); err == nil {
+			t.Errorf("limits %+v accepted", limits)
+		}
+	}
+}
+
+// TestBatchParams decodes the hex params the way the miner actor would.
+func TestBatchParams(t *testing.T) {
+	cands := []Candidate{cand(1, 0, 0, 180), cand(2, 0, 0, 180, 7, 8), cand(3, 5, 2, 360)}
+	batches, err := BuildBatches(cands, Limits{MaxSectors: 10, MaxDeclarations: 10})
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("%d batches, %v", len(batches), err)
+	}
+	b := batches[0]
+
+	raw, err := hex.DecodeString(b.ParamsHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params miner16.ExtendSectorExpiration2Params
+	if err := params.UnmarshalCBOR(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(t, params), "0/0+180 [1] 2:[7 8]-[], 5/2+360 [3]"; got != want {
+		t.Errorf("decoded %s, want %s", got, want)
+	}
+	var again bytes.Buffer
+	if err := params.MarshalCBOR(&again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), raw) {
+		t.Errorf("re-encoded %x, want %s", again.Bytes(), b.ParamsHex)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	l, err := Policy{NetworkVersion: network.Version25}.Limits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.MaxSectors != 25_000 || l.MaxDeclarations != 3_000 {
+		t.Errorf("nv25 limits %+v", l)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/filecoin-project/lotus/chain/types"
+
+	"check-sector-info/dealcache"
+	"check-sector-info/lotusclient"
+	"check-sector-info/output"
+	"check-sector-info/sectorreport"
+	timeToHeight "check-sector-info/time-height"
+)
+
+type FleetError struct {
+	Cluster string `json:"cluster,omitempty"`
+	Miner   string `json:"miner"`
+	Error   string `json:"error"`
+}
+
+// FleetReport holds one report per miner and their rollup, grouped by the
+// same dimensions.
+type FleetReport struct {
+	At       *timeToHeight.Resolution        `json:"at,omitempty"`
+	GroupBy  []string                        `json:"group_by"`
+	Clusters []Report                        `json:"clusters"`
+	Errors   []FleetError                    `json:"errors,omitempty"`
+	Days     []sectorreport.SectorInfoByDate `json:"days"`
+	Total    sectorreport.Total              `json:"total"`
+
+	withStatus bool
+	terminated int
+}
+
+// runFleet builds the report of every target, at most -j at a time. Miners
+// that fail are listed in the report instead of aborting the others, and the
+// run exits non-zero once the report is written.
+func runFleet(ctx context.Context, delegate lotusclient.Node, targets []target, tsk types.TipSetKey,
+	at *timeToHeight.Resolution, dims []sectorreport.Dimension, thresholds sectorreport.Thresholds, deals *dealcache.Cache, f output.Format) {
+	reports := make([]*Report, len(targets))
+	errs := make([]error, len(targets))
+
+	sem := make(chan struct{}, *jobs)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ms, err := loadMiner(ctx, delegate, t.addr, tsk, *withStatus, deals)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			r, err := buildReport(ctx, delegate, t, ms, tsk, nil, dims, thresholds, deals)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			reports[i] = &r
+		}()
+	}
+	wg.Wait()
+
+	fleet := FleetReport{
+		At:         at,
+		GroupBy:    sectorreport.DimensionNames(dims),
+		withStatus: *withStatus,
+	}
+	var rows [][]sectorreport.SectorInfoByDate
+	for i, t := range targets {
+		if errs[i] != nil {
+			log.Printf("cluster %s miner %s query failed,err:%s", t.Cluster, t.addr, errs[i])
+			fleet.Errors = append(fleet.Errors, FleetError{Cluster: t.Cluster, Miner: t.addr.String(), Error: errs[i].Error()})
+			continue
+		}
+		fleet.Clusters = append(fleet.Clusters, *reports[i])
+		fleet.terminated += reports[i].Terminated
+		rows = append(rows, reports[i].Days)
+	}
+	fleet.Days = sectorreport.Merge(rows...)
+	fleet.Total = sectorreport.Sum(fleet.Days)
+
+	if err := fleet.Write(os.Stdout, f); err != nil {
+		log.Fatalf("write report failed,err:%s", err)
+	}
+	if len(fleet.Errors) != 0 {
+		log.Fatalf("%d of %d miners failed", len(fleet.Errors), len(targets))
+	}
+}
+
+// rollup is the fleet total as a single report, for the writers of Report.
+func (f FleetReport) rollup() Report {
+	return Report{
+		Miner:      "fleet",
+		GroupBy:    f.GroupBy,
+		Days:       f.Days,
+		Total:      f.Total,
+		WithStatus: f.withStatus,
+		Terminated: f.terminated,
+	}
+}
+
+func (f FleetReport) Write(w io.Writer, format output.Format) error {
+	switch format {
+	case output.JSON:
+		return output.WriteJSON(w, f)
+	case output.NDJSON:
+		return f.writeNDJSON(w)
+	case output.CSV:
+		return f.writeCSV(w)
+	default:
+		f.writeText(w)
+		return nil
+	}
+}
+
+func (f FleetReport) writeText(w io.Writer) {
+	for _, r := range f.Clusters {
+		fmt.Fprintf(w, "==============集群 %s miner %s===============\n", r.Cluster, r.Miner)
+		r.writeText(w)
+		fmt.Fprintln(w)
+	}
+	for _, e := range f.Errors {
+		fmt.Fprintf(w, "集群 %s miner %s 查询失败：%s\n", e.Cluster, e.Miner, e.Error)
+	}
+	fmt.Fprintf(w, "==============全部 %d 个miner汇总===============\n", len(f.Clusters))
+	f.rollup().writeText(w)
+}
+
+func (f FleetReport) writeNDJSON(w io.Writer) error {
+	if f.At != nil {
+		if err := output.WriteNDJSON(w, "at", f.At); err != nil {
+			return err
+		}
+	}
+	for _, r := range f.Clusters {
+		if err := r.writeNDJSONTagged(w, map[string]string{"cluster": r.Cluster, "miner": r.Miner}); err != nil {
+			return err
+		}
+	}
+	for _, e := range f.Errors {
+		if err := output.WriteNDJSON(w, "error", e); err != nil {
+			return err
+		}
+	}
+	for _, s := range f.Days {
+		if err := output.WriteNDJSON(w, "fleet_day", s); err != nil {
+			return err
+		}
+	}
+	return output.WriteNDJSON(w, "fleet_total", f.Total)
+}
+
+func (f FleetReport) writeCSV(w io.Writer) error {
+	var sectors, days output.Table
+	add := func(dst *output.Table, t output.Table, cluster, miner string) {
+		if dst.Header == nil {
+			dst.Header = append([]string{"cluster", "miner"}, t.Header...)
+		}
+		for _, row := range t.Rows {
+			dst.Rows = append(dst.Rows, append([]string{cluster, miner}, row...))
+		}
+	}
+
+	for _, r := range f.Clusters {
+		if len(r.Sectors) != 0 {
+			add(&sectors, r.sectorsTable(), r.Cluster, r.Miner)
+		}
+		add(&days, r.daysTable(), r.Cluster, r.Miner)
+	}
+	add(&days, f.rollup().daysTable(), "fleet", "")
+
+	if sectors.Header == nil {
+		return output.WriteCSV(w, days)
+	}
+	return output.WriteCSV(w, sectors, days)
+}
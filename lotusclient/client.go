@@ -0,0 +1,307 @@
+package lotusclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/api/v1api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+)
+
+// Node is the part of the lotus full node API the tools use.
+type Node interface {
+	ChainHead(context.Context) (*types.TipSet, error)
+	ChainGetTipSet(context.Context, types.TipSetKey) (*types.TipSet, error)
+	ChainGetTipSetByHeight(context.Context, abi.ChainEpoch, types.TipSetKey) (*types.TipSet, error)
+	StateNetworkVersion(context.Context, types.TipSetKey) (network.Version, error)
+	StateGetNetworkParams(context.Context) (*api.NetworkParams, error)
+	StateGetClaims(context.Context, address.Address, types.TipSetKey) (map[verifreg.ClaimId]verifreg.Claim, error)
+	StateMinerActiveSectors(context.Context, address.Address, types.TipSetKey) ([]*miner.SectorOnChainInfo, error)
+	StateMinerSectors(context.Context, address.Address, *bitfield.BitField, types.TipSetKey) ([]*miner.SectorOnChainInfo, error)
+	StateMinerDeadlines(context.Context, address.Address, types.TipSetKey) ([]api.Deadline, error)
+	StateMinerPartitions(context.Context, address.Address, uint64, types.TipSetKey) ([]api.Partition, error)
+	StateMinerFaults(context.Context, address.Address, types.TipSetKey) (bitfield.BitField, error)
+	StateMinerRecoveries(context.Context, address.Address, types.TipSetKey) (bitfield.BitField, error)
+	StateMarketStorageDeal(context.Context, abi.DealID, types.TipSetKey) (*api.MarketDeal, error)
+	StateMarketDeals(context.Context, types.TipSetKey) (map[string]*api.MarketDeal, error)
+	StateGetActor(context.Context, address.Address, types.TipSetKey) (*types.Actor, error)
+	ChainReadObj(context.Context, cid.Cid) ([]byte, error)
+}
+
+var _ Node = v1api.FullNode(nil)
+
+// Retry says how a Client retries a call.
+type Retry struct {
+	// CallTimeout bounds each attempt, zero means no bound.
+	CallTimeout time.Duration
+	// Attempts is the number of tries per call, at least one.
+	Attempts int
+	// Backoff is the wait after the first failed attempt, doubled after
+	// every further one up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetry = Retry{CallTimeout: 5 * time.Minute, Attempts: 4, Backoff: time.Second, MaxBackoff: 30 * time.Second}
+
+type endpoint struct {
+	url  string
+	node Node
+}
+
+// Client calls a list of lotus endpoints, retrying retryable errors with
+// backoff and moving on to the next endpoint after each failure. It sticks
+// to the endpoint that served the last call.
+type Client struct {
+	endpoints []endpoint
+	retry     Retry
+	// Logf, when set, is told which endpoint served or failed each call.
+	Logf func(format string, args ...interface{})
+
+	lk      sync.Mutex
+	current int
+}
+
+func NewClient(nodes map[string]Node, order []string, retry Retry) *Client {
+	c := &Client{retry: retry}
+	for _, u := range order {
+		c.endpoints = append(c.endpoints, endpoint{url: u, node: nodes[u]})
+	}
+	return c
+}
+
+// Connect dials every endpoint of o. Endpoints that cannot be dialled are
+// logged and skipped, it only fails when none is left.
+func Connect(ctx context.Context, o Options, retry Retry) (*Client, jsonrpc.ClientCloser, error) {
+	eps, err := o.Endpoints()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := make(map[string]Node)
+	var order []string
+	var closers []jsonrpc.ClientCloser
+	for _, ep := range eps {
+		if _, ok := nodes[ep.URL]; ok {
+			continue
+		}
+		node, closer, err := client.NewFullNodeRPCV1(ctx, ep.URL, o.Header(ep.Token))
+		if err != nil {
+			log.Printf("connect to lotus api %s failed,err:%s", ep.URL, err)
+			continue
+		}
+		nodes[ep.URL] = node
+		order = append(order, ep.URL)
+		closers = append(closers, closer)
+	}
+	if len(order) == 0 {
+		return nil, nil, fmt.Errorf("no lotus endpoint reachable")
+	}
+
+	closeAll := func() {
+		for _, closer := range closers {
+			closer()
+		}
+	}
+	return NewClient(nodes, order, retry), closeAll, nil
+}
+
+// httpStatus matches the error go-jsonrpc returns when the node answers with
+// an http status instead of a json response, it has no typed form.
+var httpStatus = regexp.MustCompile(`^request failed, http status (\d{3})\b`)
+
+// Retryable tells transport failures and timeouts, worth another attempt,
+// from errors lotus returned for the call itself.
+func Retryable(err error) bool {
+	var connErr *jsonrpc.RPCConnectionError
+	var clientErr *jsonrpc.ErrClient
+	var netErr net.Error
+	switch {
+	case errors.As(err, &connErr), errors.As(err, &netErr):
+		return true
+	case errors.As(err, &clientErr):
+		// a rejected token or a missing endpoint will not be accepted on
+		// the next try either, a timeout or rate limit may be
+		for e := errors.Unwrap(clientErr); e != nil; e = errors.Unwrap(e) {
+			if m := httpStatus.FindStringSubmatch(e.Error()); m != nil {
+				code, _ := strconv.Atoi(m[1])
+				return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+			}
+		}
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+func call[T any](c *Client, ctx context.Context, method string, f func(context.Context, Node) (T, error)) (T, error) {
+	var zero T
+	attempts := max(c.retry.Attempts, 1)
+	wait := c.retry.Backoff
+
+	c.lk.Lock()
+	start := c.current
+	c.lk.Unlock()
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		idx := (start + i) % len(c.endpoints)
+		ep := c.endpoints[idx]
+
+		began := time.Now()
+		var res T
+		res, err = attempt(ctx, c.retry.CallTimeout, ep.node, f)
+		if err == nil {
+			c.lk.Lock()
+			c.current = idx
+			c.lk.Unlock()
+			c.logf("rpc %s served by %s in %s", method, ep.url, time.Since(began).Round(time.Millisecond))
+			return res, nil
+		}
+
+		if ctx.Err() != nil || !Retryable(err) {
+			c.logf("rpc %s failed on %s,err:%s", method, ep.url, err)
+			return zero, err
+		}
+		if i == attempts-1 {
+			break
+		}
+
+		c.logf("rpc %s failed on %s, attempt %d/%d, retrying in %s,err:%s", method, ep.url, i+1, attempts, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+		wait = min(wait*2, c.retry.MaxBackoff)
+	}
+	return zero, fmt.Errorf("rpc %s failed after %d attempts: %w", method, attempts, err)
+}
+
+func attempt[T any](ctx context.Context, timeout time.Duration, node Node, f func(context.Context, Node) (T, error)) (T, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx, node)
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+func (c *Client) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return call(c, ctx, "ChainHead", func(ctx context.Context, n Node) (*types.TipSet, error) {
+		return n.ChainHead(ctx)
+	})
+}
+
+func (c *Client) ChainGetTipSet(ctx context.Context, tsk types.TipSetKey) (*types.TipSet, error) {
+	return call(c, ctx, "ChainGetTipSet", func(ctx context.Context, n Node) (*types.TipSet, error) {
+		return n.ChainGetTipSet(ctx, tsk)
+	})
+}
+
+func (c *Client) ChainGetTipSetByHeight(ctx context.Context, h abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return call(c, ctx, "ChainGetTipSetByHeight", func(ctx context.Context, n Node) (*types.TipSet, error) {
+		return n.ChainGetTipSetByHeight(ctx, h, tsk)
+	})
+}
+
+func (c *Client) StateNetworkVersion(ctx context.Context, tsk types.TipSetKey) (network.Version, error) {
+	return call(c, ctx, "StateNetworkVersion", func(ctx context.Context, n Node) (network.Version, error) {
+		return n.StateNetworkVersion(ctx, tsk)
+	})
+}
+
+func (c *Client) StateGetNetworkParams(ctx context.Context) (*api.NetworkParams, error) {
+	return call(c, ctx, "StateGetNetworkParams", func(ctx context.Context, n Node) (*api.NetworkParams, error) {
+		return n.StateGetNetworkParams(ctx)
+	})
+}
+
+func (c *Client) StateGetClaims(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (map[verifreg.ClaimId]verifreg.Claim, error) {
+	return call(c, ctx, "StateGetClaims", func(ctx context.Context, n Node) (map[verifreg.ClaimId]verifreg.Claim, error) {
+		return n.StateGetClaims(ctx, maddr, tsk)
+	})
+}
+
+func (c *Client) StateMinerActiveSectors(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	return call(c, ctx, "StateMinerActiveSectors", func(ctx context.Context, n Node) ([]*miner.SectorOnChainInfo, error) {
+		return n.StateMinerActiveSectors(ctx, maddr, tsk)
+	})
+}
+
+func (c *Client) StateMinerSectors(ctx context.Context, maddr address.Address, sectors *bitfield.BitField, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	return call(c, ctx, "StateMinerSectors", func(ctx context.Context, n Node) ([]*miner.SectorOnChainInfo, error) {
+		return n.StateMinerSectors(ctx, maddr, sectors, tsk)
+	})
+}
+
+func (c *Client) StateMinerDeadlines(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]api.Deadline, error) {
+	return call(c, ctx, "StateMinerDeadlines", func(ctx context.Context, n Node) ([]api.Deadline, error) {
+		return n.StateMinerDeadlines(ctx, maddr, tsk)
+	})
+}
+
+func (c *Client) StateMinerPartitions(ctx context.Context, maddr address.Address, dl uint64, tsk types.TipSetKey) ([]api.Partition, error) {
+	return call(c, ctx, "StateMinerPartitions", func(ctx context.Context, n Node) ([]api.Partition, error) {
+		return n.StateMinerPartitions(ctx, maddr, dl, tsk)
+	})
+}
+
+func (c *Client) StateMinerFaults(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	return call(c, ctx, "StateMinerFaults", func(ctx context.Context, n Node) (bitfield.BitField, error) {
+		return n.StateMinerFaults(ctx, maddr, tsk)
+	})
+}
+
+func (c *Client) StateMinerRecoveries(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	return call(c, ctx, "StateMinerRecoveries", func(ctx context.Context, n Node) (bitfield.BitField, error) {
+		return n.StateMinerRecoveries(ctx, maddr, tsk)
+	})
+}
+
+func (c *Client) StateMarketStorageDeal(ctx context.Context, id abi.DealID, tsk types.TipSetKey) (*api.MarketDeal, error) {
+	return call(c, ctx, "StateMarketStorageDeal", func(ctx context.Context, n Node) (*api.MarketDeal, error) {
+		return n.StateMarketStorageDeal(ctx, id, tsk)
+	})
+}
+
+func (c *Client) StateMarketDeals(ctx context.Context, tsk types.TipSetKey) (map[string]*api.MarketDeal, error) {
+	return call(c, ctx, "StateMarketDeals", func(ctx context.Context, n Node) (map[string]*api.MarketDeal, error) {
+		return n.StateMarketDeals(ctx, tsk)
+	})
+}
+
+func (c *Client) StateGetActor(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	return call(c, ctx, "StateGetActor", func(ctx context.Context, n Node) (*types.Actor, error) {
+		return n.StateGetActor(ctx, addr, tsk)
+	})
+}
+
+func (c *Client) ChainReadObj(ctx context.Context, obj cid.Cid) ([]byte, error) {
+	return call(c, ctx, "ChainReadObj", func(ctx context.Context, n Node) ([]byte, error) {
+		return n.ChainReadObj(ctx, obj)
+	})
+}
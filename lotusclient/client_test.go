@@ -0,0 +1,174 @@
+package lotusclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// fakeNode answers ChainHead with the next of its errors, nil once they run
+// out. Other methods are not implemented.
+type fakeNode struct {
+	Node
+	errs  []error
+	delay time.Duration
+	calls int
+}
+
+func (f *fakeNode) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	f.calls++
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	return &types.TipSet{}, nil
+}
+
+var errDown = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func newTestClient(attempts int, nodes ...*fakeNode) (*Client, *[]string) {
+	m := make(map[string]Node)
+	var order []string
+	for i, n := range nodes {
+		u := fmt.Sprintf("node%d", i)
+		m[u] = n
+		order = append(order, u)
+	}
+	c := NewClient(m, order, Retry{Attempts: attempts, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, CallTimeout: 50 * time.Millisecond})
+	var logs []string
+	c.Logf = func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	return c, &logs
+}
+
+func TestFailover(t *testing.T) {
+	a := &fakeNode{errs: []error{errDown}}
+	b := &fakeNode{}
+	c, logs := newTestClient(3, a, b)
+
+	if _, err := c.ChainHead(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Errorf("calls a=%d b=%d, want 1/1", a.calls, b.calls)
+	}
+
+	// the client sticks to the endpoint that answered
+	if _, err := c.ChainHead(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if a.calls != 1 || b.calls != 2 {
+		t.Errorf("calls a=%d b=%d, want 1/2", a.calls, b.calls)
+	}
+
+	last := (*logs)[len(*logs)-1]
+	if want := "rpc ChainHead served by node1"; len(last) < len(want) || last[:len(want)] != want {
+		t.Errorf("last log %q", last)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	a := &fakeNode{errs: []error{errDown, errDown, errDown, errDown}}
+	c, _ := newTestClient(3, a)
+
+	_, err := c.ChainHead(context.Background())
+	if err == nil || !errors.Is(err, errDown) {
+		t.Fatalf("err = %v, want the connection error", err)
+	}
+	if a.calls != 3 {
+		t.Errorf("%d calls, want 3", a.calls)
+	}
+}
+
+func TestNoRetryOnCallError(t *testing.T) {
+	a := &fakeNode{errs: []error{errors.New("actor not found")}}
+	c, _ := newTestClient(3, a)
+
+	if _, err := c.ChainHead(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if a.calls != 1 {
+		t.Errorf("%d calls, want 1", a.calls)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	slow := &fakeNode{delay: time.Second}
+	fast := &fakeNode{}
+	c, _ := newTestClient(2, slow, fast)
+
+	began := time.Now()
+	if _, err := c.ChainHead(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(began) > 500*time.Millisecond {
+		t.Errorf("took %s, the call timeout did not apply", time.Since(began))
+	}
+	if fast.calls != 1 {
+		t.Errorf("fast node got %d calls", fast.calls)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errDown, true},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{errors.New("actor not found"), false},
+		{errors.New("request failed, http status 401 Unauthorized"), false},
+	} {
+		if got := Retryable(tc.err); got != tc.want {
+			t.Errorf("Retryable(%v) = %v", tc.err, got)
+		}
+	}
+
+	// errors of a real jsonrpc client against a node answering with status
+	for status, want := range map[int]bool{
+		http.StatusUnauthorized:       false,
+		http.StatusForbidden:          false,
+		http.StatusNotFound:           false,
+		http.StatusRequestTimeout:     true,
+		http.StatusTooManyRequests:    true,
+		http.StatusBadGateway:         false,
+		http.StatusServiceUnavailable: false,
+		// a 200 that is not a json response
+		http.StatusOK: true,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, "not json")
+		}))
+		var node struct {
+			ChainHead func(context.Context) (*types.TipSet, error)
+		}
+		closer, err := jsonrpc.NewMergeClient(context.Background(), srv.URL, "Filecoin", []interface{}{&node}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = node.ChainHead(context.Background())
+		if got := Retryable(err); got != want {
+			t.Errorf("status %d: Retryable(%v) = %v, want %v", status, err, got, want)
+		}
+		closer()
+		srv.Close()
+	}
+}
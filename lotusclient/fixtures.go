@@ -0,0 +1,220 @@
+package lotusclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+)
+
+// ErrNotRecorded is returned in replay mode for calls missing from the
+// fixture directory.
+var ErrNotRecorded = errors.New("call was not recorded")
+
+// Fixtures stores every response of a run in a directory, one file per
+// method and parameters, and serves a later run from it without a node.
+type Fixtures struct {
+	dir string
+	// node is nil when replaying
+	node Node
+}
+
+// NewRecorder passes calls through to node and saves each response in dir.
+func NewRecorder(dir string, node Node) (*Fixtures, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Fixtures{dir: dir, node: node}, nil
+}
+
+// NewReplayer answers calls from the responses recorded in dir.
+func NewReplayer(dir string) (*Fixtures, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &Fixtures{dir: dir}, nil
+}
+
+type fixture struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+// path is <dir>/<method>/<sha256 of the json params>.json, the tipset key
+// being one of the params.
+func (f *Fixtures) path(method string, params []byte) string {
+	sum := sha256.Sum256(params)
+	return filepath.Join(f.dir, method, hex.EncodeToString(sum[:16])+".json")
+}
+
+func fixtureCall[T any](f *Fixtures, ctx context.Context, method string, params []interface{}, call func(context.Context, Node) (T, error)) (T, error) {
+	var res T
+	p, err := json.Marshal(params)
+	if err != nil {
+		return res, fmt.Errorf("encode %s params: %w", method, err)
+	}
+	path := f.path(method, p)
+
+	if f.node == nil {
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return res, fmt.Errorf("%s %s: %w", method, p, ErrNotRecorded)
+		}
+		if err != nil {
+			return res, err
+		}
+		var fx fixture
+		if err := json.Unmarshal(b, &fx); err != nil {
+			return res, fmt.Errorf("read fixture %s: %w", path, err)
+		}
+		if err := json.Unmarshal(fx.Result, &res); err != nil {
+			return res, fmt.Errorf("decode fixture %s: %w", path, err)
+		}
+		return res, nil
+	}
+
+	res, err = call(ctx, f.node)
+	if err != nil {
+		return res, err
+	}
+	r, err := json.Marshal(res)
+	if err != nil {
+		return res, fmt.Errorf("encode %s result: %w", method, err)
+	}
+	b, err := json.MarshalIndent(fixture{Method: method, Params: p, Result: r}, "", "\t")
+	if err != nil {
+		return res, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return res, err
+	}
+	// concurrent calls with the same key write the same content, the rename
+	// keeps readers from seeing half a file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fixture-*")
+	if err != nil {
+		return res, err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return res, fmt.Errorf("write fixture %s: %w", path, err)
+	}
+	return res, nil
+}
+
+func (f *Fixtures) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return fixtureCall(f, ctx, "ChainHead", nil, func(ctx context.Context, n Node) (*types.TipSet, error) {
+		return n.ChainHead(ctx)
+	})
+}
+
+func (f *Fixtures) ChainGetTipSet(ctx context.Context, tsk types.TipSetKey) (*types.TipSet, error) {
+	return fixtureCall(f, ctx, "ChainGetTipSet", []interface{}{tsk}, func(ctx context.Context, n Node) (*types.TipSet, error) {
+		return n.ChainGetTipSet(ctx, tsk)
+	})
+}
+
+func (f *Fixtures) ChainGetTipSetByHeight(ctx context.Context, h abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return fixtureCall(f, ctx, "ChainGetTipSetByHeight", []interface{}{h, tsk}, func(ctx context.Context, n Node) (*types.TipSet, error) {
+		return n.ChainGetTipSetByHeight(ctx, h, tsk)
+	})
+}
+
+func (f *Fixtures) StateNetworkVersion(ctx context.Context, tsk types.TipSetKey) (network.Version, error) {
+	return fixtureCall(f, ctx, "StateNetworkVersion", []interface{}{tsk}, func(ctx context.Context, n Node) (network.Version, error) {
+		return n.StateNetworkVersion(ctx, tsk)
+	})
+}
+
+func (f *Fixtures) StateGetNetworkParams(ctx context.Context) (*api.NetworkParams, error) {
+	return fixtureCall(f, ctx, "StateGetNetworkParams", nil, func(ctx context.Context, n Node) (*api.NetworkParams, error) {
+		return n.StateGetNetworkParams(ctx)
+	})
+}
+
+func (f *Fixtures) StateGetClaims(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (map[verifreg.ClaimId]verifreg.Claim, error) {
+	return fixtureCall(f, ctx, "StateGetClaims", []interface{}{maddr, tsk}, func(ctx context.Context, n Node) (map[verifreg.ClaimId]verifreg.Claim, error) {
+		return n.StateGetClaims(ctx, maddr, tsk)
+	})
+}
+
+func (f *Fixtures) StateMinerActiveSectors(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	return fixtureCall(f, ctx, "StateMinerActiveSectors", []interface{}{maddr, tsk}, func(ctx context.Context, n Node) ([]*miner.SectorOnChainInfo, error) {
+		return n.StateMinerActiveSectors(ctx, maddr, tsk)
+	})
+}
+
+func (f *Fixtures) StateMinerSectors(ctx context.Context, maddr address.Address, sectors *bitfield.BitField, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	return fixtureCall(f, ctx, "StateMinerSectors", []interface{}{maddr, sectors, tsk}, func(ctx context.Context, n Node) ([]*miner.SectorOnChainInfo, error) {
+		return n.StateMinerSectors(ctx, maddr, sectors, tsk)
+	})
+}
+
+func (f *Fixtures) StateMinerDeadlines(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]api.Deadline, error) {
+	return fixtureCall(f, ctx, "StateMinerDeadlines", []interface{}{maddr, tsk}, func(ctx context.Context, n Node) ([]api.Deadline, error) {
+		return n.StateMinerDeadlines(ctx, maddr, tsk)
+	})
+}
+
+func (f *Fixtures) StateMinerPartitions(ctx context.Context, maddr address.Address, dl uint64, tsk types.TipSetKey) ([]api.Partition, error) {
+	return fixtureCall(f, ctx, "StateMinerPartitions", []interface{}{maddr, dl, tsk}, func(ctx context.Context, n Node) ([]api.Partition, error) {
+		return n.StateMinerPartitions(ctx, maddr, dl, tsk)
+	})
+}
+
+func (f *Fixtures) StateMinerFaults(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	return fixtureCall(f, ctx, "StateMinerFaults", []interface{}{maddr, tsk}, func(ctx context.Context, n Node) (bitfield.BitField, error) {
+		return n.StateMinerFaults(ctx, maddr, tsk)
+	})
+}
+
+func (f *Fixtures) StateMinerRecoveries(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	return fixtureCall(f, ctx, "StateMinerRecoveries", []interface{}{maddr, tsk}, func(ctx context.Context, n Node) (bitfield.BitField, error) {
+		return n.StateMinerRecoveries(ctx, maddr, tsk)
+	})
+}
+
+func (f *Fixtures) StateMarketStorageDeal(ctx context.Context, id abi.DealID, tsk types.TipSetKey) (*api.MarketDeal, error) {
+	return fixtureCall(f, ctx, "StateMarketStorageDeal", []interface{}{id, tsk}, func(ctx context.Context, n Node) (*api.MarketDeal, error) {
+		return n.StateMarketStorageDeal(ctx, id, tsk)
+	})
+}
+
+func (f *Fixtures) StateMarketDeals(ctx context.Context, tsk types.TipSetKey) (map[string]*api.MarketDeal, error) {
+	return fixtureCall(f, ctx, "StateMarketDeals", []interface{}{tsk}, func(ctx context.Context, n Node) (map[string]*api.MarketDeal, error) {
+		return n.StateMarketDeals(ctx, tsk)
+	})
+}
+
+func (f *Fixtures) StateGetActor(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	return fixtureCall(f, ctx, "StateGetActor", []interface{}{addr, tsk}, func(ctx context.Context, n Node) (*types.Actor, error) {
+		return n.StateGetActor(ctx, addr, tsk)
+	})
+}
+
+func (f *Fixtures) ChainReadObj(ctx context.Context, obj cid.Cid) ([]byte, error) {
+	return fixtureCall(f, ctx, "ChainReadObj", []interface{}{obj}, func(ctx context.Context, n Node) ([]byte, error) {
+		return n.ChainReadObj(ctx, obj)
+	})
+}
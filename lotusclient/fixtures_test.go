@@ -0,0 +1,172 @@
+package lotusclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+)
+
+var testCid, _ = cid.Parse("bagboea4b5abcatlxechwbp7kjpjguna6r6q7ejrhe6mdp3lf34pmswn27pkkiekz")
+
+type chainNode struct {
+	Node
+	head    *types.TipSet
+	sectors []*miner.SectorOnChainInfo
+	calls   int
+}
+
+func (n *chainNode) ChainHead(context.Context) (*types.TipSet, error) {
+	n.calls++
+	return n.head, nil
+}
+
+func (n *chainNode) StateMinerActiveSectors(_ context.Context, _ address.Address, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	n.calls++
+	if tsk != n.head.Key() {
+		return nil, errors.New("unknown tipset")
+	}
+	return n.sectors, nil
+}
+
+func (n *chainNode) StateMinerFaults(context.Context, address.Address, types.TipSetKey) (bitfield.BitField, error) {
+	n.calls++
+	return bitfield.NewFromSet([]uint64{2, 5, 6}), nil
+}
+
+func (n *chainNode) StateGetClaims(context.Context, address.Address, types.TipSetKey) (map[verifreg.ClaimId]verifreg.Claim, error) {
+	n.calls++
+	return map[verifreg.ClaimId]verifreg.Claim{7: {Sector: 2, TermMax: 100, Data: testCid}}, nil
+}
+
+func testHead(t *testing.T) *types.TipSet {
+	miner, _ := address.NewIDAddress(1000)
+	ts, err := types.NewTipSet([]*types.BlockHeader{{
+		Miner:                 miner,
+		Ticket:                &types.Ticket{VRFProof: []byte{1}},
+		ElectionProof:         &types.ElectionProof{},
+		Height:                4_000_000,
+		Parents:               []cid.Cid{testCid},
+		ParentWeight:          big.NewInt(10),
+		ParentStateRoot:       testCid,
+		ParentMessageReceipts: testCid,
+		Messages:              testCid,
+		ParentBaseFee:         big.NewInt(100),
+		Timestamp:             1718306400,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	maddr, _ := address.NewIDAddress(1234)
+
+	day := big.NewInt(12345)
+	node := &chainNode{
+		head: testHead(t),
+		sectors: []*miner.SectorOnChainInfo{{
+			SectorNumber:       2,
+			SealProof:          abi.RegisteredSealProof_StackedDrg32GiBV1_1,
+			SealedCID:          testCid,
+			Activation:         100,
+			Expiration:         5_000_000,
+			DealWeight:         big.Zero(),
+			VerifiedDealWeight: big.NewInt(99),
+			InitialPledge:      big.NewInt(1e18),
+			ExpectedDayReward:  &day,
+			SectorKeyCID:       &testCid,
+			DailyFee:           big.Zero(),
+		}},
+	}
+
+	rec, err := NewRecorder(dir, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := rec.ChainHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectors, err := rec.StateMinerActiveSectors(ctx, maddr, head.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	faults, err := rec.StateMinerFaults(ctx, maddr, head.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := rec.StateGetClaims(ctx, maddr, head.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// errors are passed through and not recorded
+	if _, err := rec.StateMinerActiveSectors(ctx, maddr, types.EmptyTSK); err == nil {
+		t.Fatal("expected the node's error")
+	}
+
+	calls := node.calls
+	replay, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotHead, err := replay.ChainHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotHead.Equals(head) {
+		t.Errorf("replayed head %s, want %s", gotHead.Key(), head.Key())
+	}
+
+	gotSectors, err := replay.StateMinerActiveSectors(ctx, maddr, gotHead.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotSectors, sectors) {
+		t.Errorf("replayed sectors %+v, want %+v", gotSectors[0], sectors[0])
+	}
+
+	gotFaults, err := replay.StateMinerFaults(ctx, maddr, gotHead.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := faults.All(10)
+	got, _ := gotFaults.All(10)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed faults %v, want %v", got, want)
+	}
+
+	gotClaims, err := replay.StateGetClaims(ctx, maddr, gotHead.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotClaims, claims) {
+		t.Errorf("replayed claims %v, want %v", gotClaims, claims)
+	}
+
+	if node.calls != calls {
+		t.Errorf("replay reached the node")
+	}
+
+	// other params are a different key
+	other, _ := address.NewIDAddress(4321)
+	if _, err := replay.StateMinerActiveSectors(ctx, other, gotHead.Key()); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("err = %v, want ErrNotRecorded", err)
+	}
+	if _, err := replay.StateMinerActiveSectors(ctx, maddr, types.EmptyTSK); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("err = %v, want ErrNotRecorded", err)
+	}
+}
@@ -0,0 +1,105 @@
+package lotusclient
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"check-sector-info/config"
+)
+
+const DefaultURL = "http://127.0.0.1:1234/rpc/v0"
+
+// Options say how to reach a lotus node. Empty fields are filled by WithEnv.
+type Options struct {
+	URL     string
+	Token   string
+	Headers Headers
+}
+
+// Headers collects repeated -H "Key: Value" flags.
+type Headers []string
+
+func (h *Headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *Headers) Set(v string) error {
+	if _, _, ok := strings.Cut(v, ":"); !ok {
+		return fmt.Errorf("header %q is not in Key: Value form", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// Endpoint is one lotus node and the token to send it.
+type Endpoint struct {
+	URL   string
+	Token string
+}
+
+// Endpoints lists the nodes to use, in failover order. URL may hold several
+// comma separated urls, multiaddrs or token:multiaddr, see
+// config.ParseAPIInfo, when empty the entries of FULLNODE_API_INFO are used,
+// and DefaultURL when that is unset too. The token comes from Token, then
+// TOKEN, the same variable the rebuild tool reads, then FULLNODE_API_INFO.
+func (o Options) Endpoints() ([]Endpoint, error) {
+	token := o.Token
+	if token == "" {
+		token = os.Getenv("TOKEN")
+	}
+
+	var infos []Endpoint
+	if info := os.Getenv("FULLNODE_API_INFO"); info != "" {
+		for _, entry := range strings.Split(info, ",") {
+			t, u, err := config.ParseAPIInfo(strings.TrimSpace(entry))
+			if err != nil {
+				return nil, fmt.Errorf("FULLNODE_API_INFO: %w", err)
+			}
+			infos = append(infos, Endpoint{URL: u, Token: t})
+		}
+	}
+
+	var eps []Endpoint
+	switch {
+	case o.URL != "":
+		for _, entry := range strings.Split(o.URL, ",") {
+			t, u, err := config.ParseAPIInfo(strings.TrimSpace(entry))
+			if err != nil {
+				return nil, err
+			}
+			ep := Endpoint{URL: u, Token: token}
+			if ep.Token == "" {
+				ep.Token = t
+			}
+			if ep.Token == "" && len(infos) > 0 {
+				ep.Token = infos[0].Token
+			}
+			eps = append(eps, ep)
+		}
+	case len(infos) > 0:
+		for _, ep := range infos {
+			if token != "" {
+				ep.Token = token
+			}
+			eps = append(eps, ep)
+		}
+	default:
+		eps = []Endpoint{{URL: DefaultURL, Token: token}}
+	}
+	return eps, nil
+}
+
+// Header is the http header sent to an endpoint with the given token.
+func (o Options) Header(token string) http.Header {
+	header := http.Header{}
+	for _, h := range o.Headers {
+		k, v, _ := strings.Cut(h, ":")
+		header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header
+}
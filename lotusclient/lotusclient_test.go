@@ -0,0 +1,60 @@
+package lotusclient
+
+import "testing"
+
+func TestEndpoints(t *testing.T) {
+	t.Setenv("FULLNODE_API_INFO", "infotoken:/ip4/10.0.0.5/tcp/1234/http")
+	t.Setenv("TOKEN", "")
+
+	eps, err := Options{}.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 1 || eps[0].URL != "ws://10.0.0.5:1234/rpc/v1" || eps[0].Token != "infotoken" {
+		t.Errorf("from api info: %+v", eps)
+	}
+
+	eps, _ = Options{URL: "http://a:1234/rpc/v0, http://b:1234/rpc/v0"}.Endpoints()
+	if len(eps) != 2 || eps[1].URL != "http://b:1234/rpc/v0" || eps[1].Token != "infotoken" {
+		t.Errorf("flag urls: %+v", eps)
+	}
+
+	t.Setenv("TOKEN", "envtoken")
+	eps, _ = Options{URL: "http://lotus:1234/rpc/v0"}.Endpoints()
+	if eps[0].URL != "http://lotus:1234/rpc/v0" || eps[0].Token != "envtoken" {
+		t.Errorf("flag url with env token: %+v", eps)
+	}
+
+	eps, _ = Options{Token: "flagtoken"}.Endpoints()
+	if eps[0].Token != "flagtoken" {
+		t.Errorf("flag token lost: %+v", eps)
+	}
+
+	t.Setenv("TOKEN", "")
+	t.Setenv("FULLNODE_API_INFO", "tok1:/ip4/10.0.0.5/tcp/1234/http,tok2:/ip4/10.0.0.6/tcp/1234/http")
+	eps, _ = Options{}.Endpoints()
+	if len(eps) != 2 || eps[0].Token != "tok1" || eps[1].Token != "tok2" {
+		t.Errorf("multiple api infos: %+v", eps)
+	}
+
+	t.Setenv("FULLNODE_API_INFO", "")
+	eps, _ = Options{}.Endpoints()
+	if len(eps) != 1 || eps[0].URL != DefaultURL {
+		t.Errorf("default url: %+v", eps)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	var h Headers
+	if err := h.Set("X-Cluster: hk01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Set("no colon"); err == nil {
+		t.Error("expected an error for a header without colon")
+	}
+
+	header := Options{Headers: h}.Header("tok")
+	if header.Get("X-Cluster") != "hk01" || header.Get("Authorization") != "Bearer tok" {
+		t.Errorf("header = %v", header)
+	}
+}
@@ -0,0 +1,314 @@
+package lotustest
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// DriverName is the database/sql driver of the stand-in ops database. Its
+// DSN is a directory: queries of cluster_list are answered from
+// clusters.json, filtered by name when given one argument, schema_version
+// is kept in schema_version.json, and every statement run is appended to
+// statements.log, so that a tool run in another process can be checked
+// afterwards.
+const DriverName = "lotustest"
+
+func init() {
+	sql.Register(DriverName, fakeDriver{})
+}
+
+type Cluster struct {
+	Name  string `json:"name"`
+	Miner string `json:"f0"`
+}
+
+// Statement is one statement the tool ran, with its arguments.
+type Statement struct {
+	Query string `json:"query"`
+	Args  []any  `json:"args,omitempty"`
+}
+
+// NewDB returns the DSN of a stand-in database holding clusters.
+func NewDB(t testing.TB, clusters []Cluster) string {
+	dir := t.TempDir()
+	b, err := json.Marshal(clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "clusters.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// FailOn makes the statements of the database at dsn that contain substr
+// fail from now on, including in other processes.
+func FailOn(t testing.TB, dsn, substr string) {
+	if err := os.WriteFile(filepath.Join(dsn, "fail"), []byte(substr), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// SetSchemaVersion creates schema_version in the database at dsn holding
+// the versions 1 to v.
+func SetSchemaVersion(t testing.TB, dsn string, v int) {
+	versions := []int64{}
+	for i := 1; i <= v; i++ {
+		versions = append(versions, int64(i))
+	}
+	if err := writeVersions(dsn, versions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readVersions(dir string) ([]int64, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "schema_version.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("table schema_version doesn't exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []int64
+	return versions, json.Unmarshal(b, &versions)
+}
+
+func writeVersions(dir string, versions []int64) error {
+	b, err := json.Marshal(versions)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "schema_version.json"), b, 0o644)
+}
+
+// execVersion keeps schema_version.json in step with the statements on
+// schema_version.
+func (c *fakeConn) execVersion(query string, args []driver.NamedValue) error {
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_version"):
+		if _, err := readVersions(c.dir); err != nil {
+			return writeVersions(c.dir, []int64{})
+		}
+		return nil
+	case strings.HasPrefix(query, "INSERT INTO schema_version"), strings.HasPrefix(query, "DELETE FROM schema_version"):
+		versions, err := readVersions(c.dir)
+		if err != nil {
+			return err
+		}
+		v, ok := args[0].Value.(int64)
+		if !ok {
+			return fmt.Errorf("version %v is not an integer", args[0].Value)
+		}
+		kept := []int64{}
+		for _, have := range versions {
+			if have != v {
+				kept = append(kept, have)
+			}
+		}
+		if strings.HasPrefix(query, "INSERT") {
+			if len(kept) != len(versions) {
+				return fmt.Errorf("duplicate schema_version %d", v)
+			}
+			kept = append(kept, v)
+		}
+		return writeVersions(c.dir, kept)
+	}
+	return nil
+}
+
+// Statements returns what was run against the database at dsn, in order.
+func Statements(t testing.TB, dsn string) []Statement {
+	f, err := os.Open(filepath.Join(dsn, "statements.log"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var stmts []Statement
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s Statement
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		stmts = append(stmts, s)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return stmts
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	if _, err := os.Stat(filepath.Join(dsn, "clusters.json")); err != nil {
+		return nil, fmt.Errorf("open stand-in database: %w", err)
+	}
+	return &fakeConn{dir: dsn}, nil
+}
+
+var logLk sync.Mutex
+
+type fakeConn struct {
+	dir string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if err := c.log("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return fakeTx{c}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.log(query, args); err != nil {
+		return nil, err
+	}
+	if b, err := os.ReadFile(filepath.Join(c.dir, "fail")); err == nil && strings.Contains(query, string(b)) {
+		return nil, errors.New("injected failure")
+	}
+	if err := c.execVersion(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.log(query, args); err != nil {
+		return nil, err
+	}
+	if strings.Contains(query, "FROM schema_version") {
+		versions, err := readVersions(c.dir)
+		if err != nil {
+			return nil, err
+		}
+		var v int64
+		for _, have := range versions {
+			v = max(v, have)
+		}
+		return &fakeRows{columns: []string{"version"}, values: [][]driver.Value{{v}}}, nil
+	}
+	if !strings.Contains(query, "cluster_list") {
+		return &fakeRows{}, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.dir, "clusters.json"))
+	if err != nil {
+		return nil, err
+	}
+	var clusters []Cluster
+	if err := json.Unmarshal(b, &clusters); err != nil {
+		return nil, err
+	}
+	// a single argument is the name of the cluster asked for
+	if len(args) == 1 {
+		rows := &fakeRows{columns: []string{"f0"}}
+		for _, cl := range clusters {
+			if cl.Name == args[0].Value {
+				rows.values = append(rows.values, []driver.Value{cl.Miner})
+			}
+		}
+		return rows, nil
+	}
+	rows := &fakeRows{columns: []string{"name", "f0"}}
+	for _, cl := range clusters {
+		rows.values = append(rows.values, []driver.Value{cl.Name, cl.Miner})
+	}
+	return rows, nil
+}
+
+func (c *fakeConn) log(query string, args []driver.NamedValue) error {
+	s := Statement{Query: query}
+	for _, a := range args {
+		s.Args = append(s.Args, a.Value)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	logLk.Lock()
+	defer logLk.Unlock()
+	f, err := os.OpenFile(filepath.Join(c.dir, "statements.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type fakeTx struct {
+	c *fakeConn
+}
+
+func (tx fakeTx) Commit() error   { return tx.c.log("COMMIT", nil) }
+func (tx fakeTx) Rollback() error { return tx.c.log("ROLLBACK", nil) }
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nv
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
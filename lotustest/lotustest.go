@@ -0,0 +1,468 @@
+// Package lotustest serves a programmable chain over an in-process lotus
+// JSON-RPC endpoint, for end to end tests of the tools.
+package lotustest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/blockstore"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/verifreg"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/ipfs/go-cid"
+)
+
+const deadlines = 48
+
+var placeholder, _ = cid.Parse("bafkqaaa")
+
+// Chain is the state the server answers from. The miner and deal state is
+// the same at every tipset, only the tipsets themselves differ by height.
+type Chain struct {
+	NetworkName    string
+	Genesis        uint64 // unix seconds, defaults to mainnet
+	BlockDelay     uint64 // seconds, defaults to 30
+	NetworkVersion network.Version
+	Head           abi.ChainEpoch
+	// Null heights have no tipset, lookups get the one before.
+	Null map[abi.ChainEpoch]bool
+
+	Miners map[address.Address]*Miner
+	Deals  map[abi.DealID]*api.MarketDeal
+}
+
+// Miner is one storage provider. Sectors are placed in deadline n%48,
+// partition 0, unless Locations says otherwise.
+type Miner struct {
+	Sectors    []*miner.SectorOnChainInfo
+	Faulty     map[abi.SectorNumber]bool
+	Recovering map[abi.SectorNumber]bool
+	Terminated map[abi.SectorNumber]bool
+	Locations  map[abi.SectorNumber][2]uint64
+	PreCommits map[abi.SectorNumber]*miner.SectorPreCommitOnChainInfo
+	Claims     map[verifreg.ClaimId]verifreg.Claim
+}
+
+func (m *Miner) location(n abi.SectorNumber) (uint64, uint64) {
+	if loc, ok := m.Locations[n]; ok {
+		return loc[0], loc[1]
+	}
+	return uint64(n) % deadlines, 0
+}
+
+type Server struct {
+	URL   string
+	chain *Chain
+
+	lk      sync.Mutex
+	calls   map[string]int
+	tipsets map[abi.ChainEpoch]*types.TipSet
+	heights map[types.TipSetKey]abi.ChainEpoch
+
+	// blocks holds the market state served by ChainReadObj
+	blocksLk sync.Mutex
+	blocks   blockstore.MemBlockstore
+}
+
+// NewServer serves chain until the test ends. URL is the rpc endpoint.
+func NewServer(t testing.TB, chain *Chain) *Server {
+	if chain.Genesis == 0 {
+		chain.Genesis = 1598306400
+	}
+	if chain.BlockDelay == 0 {
+		chain.BlockDelay = 30
+	}
+	if chain.NetworkName == "" {
+		chain.NetworkName = "mainnet"
+	}
+	if chain.NetworkVersion == 0 {
+		chain.NetworkVersion = network.Version25
+	}
+
+	s := &Server{
+		chain:   chain,
+		calls:   make(map[string]int),
+		tipsets: make(map[abi.ChainEpoch]*types.TipSet),
+		heights: make(map[types.TipSetKey]abi.ChainEpoch),
+		blocks:  blockstore.NewMemory(),
+	}
+	rpc := jsonrpc.NewServer()
+	rpc.Register("Filecoin", &handler{s})
+	srv := httptest.NewServer(rpc)
+	t.Cleanup(srv.Close)
+
+	s.URL = srv.URL + "/rpc/v1"
+	return s
+}
+
+// Calls returns how often method was called.
+func (s *Server) Calls(method string) int {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.calls[method]
+}
+
+func (s *Server) called(method string) {
+	s.lk.Lock()
+	s.calls[method]++
+	s.lk.Unlock()
+}
+
+// TipSet returns the tipset at h, or the one before it when h is null.
+func (s *Server) TipSet(h abi.ChainEpoch) (*types.TipSet, error) {
+	if h > s.chain.Head {
+		return nil, fmt.Errorf("looking for tipset with height greater than start point")
+	}
+	for h > 0 && s.chain.Null[h] {
+		h--
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if ts, ok := s.tipsets[h]; ok {
+		return ts, nil
+	}
+
+	maddr, _ := address.NewIDAddress(1000)
+	ts, err := types.NewTipSet([]*types.BlockHeader{{
+		Miner:                 maddr,
+		Ticket:                &types.Ticket{VRFProof: binary.BigEndian.AppendUint64(nil, uint64(h))},
+		ElectionProof:         &types.ElectionProof{},
+		Height:                h,
+		Parents:               []cid.Cid{placeholder},
+		ParentWeight:          big.Zero(),
+		ParentStateRoot:       placeholder,
+		ParentMessageReceipts: placeholder,
+		Messages:              placeholder,
+		ParentBaseFee:         big.NewInt(100),
+		Timestamp:             s.chain.Genesis + uint64(h)*s.chain.BlockDelay,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	s.tipsets[h] = ts
+	s.heights[ts.Key()] = h
+	return ts, nil
+}
+
+func (s *Server) lookup(tsk types.TipSetKey) error {
+	if tsk.IsEmpty() {
+		return nil
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if _, ok := s.heights[tsk]; !ok {
+		return fmt.Errorf("loading tipset %s: not found", tsk)
+	}
+	return nil
+}
+
+func (s *Server) miner(maddr address.Address, tsk types.TipSetKey) (*Miner, error) {
+	if err := s.lookup(tsk); err != nil {
+		return nil, err
+	}
+	m, ok := s.chain.Miners[maddr]
+	if !ok {
+		return nil, fmt.Errorf("actor not found")
+	}
+	return m, nil
+}
+
+// handler holds the lotus methods, the names and signatures are those of
+// v1api.FullNode.
+type handler struct {
+	s *Server
+}
+
+func (h *handler) ChainHead(context.Context) (*types.TipSet, error) {
+	h.s.called("ChainHead")
+	return h.s.TipSet(h.s.chain.Head)
+}
+
+func (h *handler) ChainGetTipSet(_ context.Context, tsk types.TipSetKey) (*types.TipSet, error) {
+	h.s.called("ChainGetTipSet")
+	if tsk.IsEmpty() {
+		return h.s.TipSet(h.s.chain.Head)
+	}
+	if err := h.s.lookup(tsk); err != nil {
+		return nil, err
+	}
+	h.s.lk.Lock()
+	height := h.s.heights[tsk]
+	h.s.lk.Unlock()
+	return h.s.TipSet(height)
+}
+
+func (h *handler) ChainGetTipSetByHeight(_ context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	h.s.called("ChainGetTipSetByHeight")
+	if err := h.s.lookup(tsk); err != nil {
+		return nil, err
+	}
+	return h.s.TipSet(height)
+}
+
+func (h *handler) StateNetworkName(context.Context) (dtypes.NetworkName, error) {
+	h.s.called("StateNetworkName")
+	return dtypes.NetworkName(h.s.chain.NetworkName), nil
+}
+
+func (h *handler) StateNetworkVersion(_ context.Context, tsk types.TipSetKey) (network.Version, error) {
+	h.s.called("StateNetworkVersion")
+	return h.s.chain.NetworkVersion, h.s.lookup(tsk)
+}
+
+func (h *handler) StateGetNetworkParams(context.Context) (*api.NetworkParams, error) {
+	h.s.called("StateGetNetworkParams")
+	return &api.NetworkParams{
+		NetworkName:      dtypes.NetworkName(h.s.chain.NetworkName),
+		BlockDelaySecs:   h.s.chain.BlockDelay,
+		GenesisTimestamp: h.s.chain.Genesis,
+	}, nil
+}
+
+func (h *handler) StateGetClaims(_ context.Context, maddr address.Address, tsk types.TipSetKey) (map[verifreg.ClaimId]verifreg.Claim, error) {
+	h.s.called("StateGetClaims")
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	claims := m.Claims
+	if claims == nil {
+		claims = map[verifreg.ClaimId]verifreg.Claim{}
+	}
+	return claims, nil
+}
+
+func (h *handler) StateMinerActiveSectors(_ context.Context, maddr address.Address, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	h.s.called("StateMinerActiveSectors")
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	var active []*miner.SectorOnChainInfo
+	for _, s := range m.Sectors {
+		if !m.Terminated[s.SectorNumber] && !m.Faulty[s.SectorNumber] && !m.Recovering[s.SectorNumber] {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+func (h *handler) StateMinerSectors(_ context.Context, maddr address.Address, filter *bitfield.BitField, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	h.s.called("StateMinerSectors")
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return m.Sectors, nil
+	}
+	var sectors []*miner.SectorOnChainInfo
+	for _, s := range m.Sectors {
+		if ok, err := filter.IsSet(uint64(s.SectorNumber)); err != nil {
+			return nil, err
+		} else if ok {
+			sectors = append(sectors, s)
+		}
+	}
+	return sectors, nil
+}
+
+func (h *handler) StateMinerDeadlines(_ context.Context, maddr address.Address, tsk types.TipSetKey) ([]api.Deadline, error) {
+	h.s.called("StateMinerDeadlines")
+	if _, err := h.s.miner(maddr, tsk); err != nil {
+		return nil, err
+	}
+	dls := make([]api.Deadline, deadlines)
+	for i := range dls {
+		dls[i] = api.Deadline{PostSubmissions: bitfield.New(), DailyFee: big.Zero()}
+	}
+	return dls, nil
+}
+
+func (h *handler) StateMinerPartitions(_ context.Context, maddr address.Address, dlIdx uint64, tsk types.TipSetKey) ([]api.Partition, error) {
+	h.s.called("StateMinerPartitions")
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	type sets struct{ all, live, faulty, recovering, active []uint64 }
+	parts := map[uint64]*sets{}
+	for _, s := range m.Sectors {
+		dl, part := m.location(s.SectorNumber)
+		if dl != dlIdx {
+			continue
+		}
+		p, ok := parts[part]
+		if !ok {
+			p = &sets{}
+			parts[part] = p
+		}
+		n := s.SectorNumber
+		p.all = append(p.all, uint64(n))
+		if m.Terminated[n] {
+			continue
+		}
+		p.live = append(p.live, uint64(n))
+		switch {
+		case m.Recovering[n]:
+			p.faulty = append(p.faulty, uint64(n))
+			p.recovering = append(p.recovering, uint64(n))
+		case m.Faulty[n]:
+			p.faulty = append(p.faulty, uint64(n))
+		default:
+			p.active = append(p.active, uint64(n))
+		}
+	}
+
+	var idx []uint64
+	for i := range parts {
+		idx = append(idx, i)
+	}
+	sort.Slice(idx, func(i, j int) bool { return idx[i] < idx[j] })
+
+	var out []api.Partition
+	for _, i := range idx {
+		for uint64(len(out)) < i {
+			out = append(out, api.Partition{AllSectors: bitfield.New(), FaultySectors: bitfield.New(), RecoveringSectors: bitfield.New(), LiveSectors: bitfield.New(), ActiveSectors: bitfield.New()})
+		}
+		p := parts[i]
+		out = append(out, api.Partition{
+			AllSectors:        bitfield.NewFromSet(p.all),
+			FaultySectors:     bitfield.NewFromSet(p.faulty),
+			RecoveringSectors: bitfield.NewFromSet(p.recovering),
+			LiveSectors:       bitfield.NewFromSet(p.live),
+			ActiveSectors:     bitfield.NewFromSet(p.active),
+		})
+	}
+	return out, nil
+}
+
+func (h *handler) sectorSet(maddr address.Address, tsk types.TipSetKey, in func(*Miner, abi.SectorNumber) bool) (bitfield.BitField, error) {
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return bitfield.New(), err
+	}
+	var set []uint64
+	for _, s := range m.Sectors {
+		if !m.Terminated[s.SectorNumber] && in(m, s.SectorNumber) {
+			set = append(set, uint64(s.SectorNumber))
+		}
+	}
+	return bitfield.NewFromSet(set), nil
+}
+
+func (h *handler) StateMinerFaults(_ context.Context, maddr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	h.s.called("StateMinerFaults")
+	return h.sectorSet(maddr, tsk, func(m *Miner, n abi.SectorNumber) bool { return m.Faulty[n] || m.Recovering[n] })
+}
+
+func (h *handler) StateMinerRecoveries(_ context.Context, maddr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	h.s.called("StateMinerRecoveries")
+	return h.sectorSet(maddr, tsk, func(m *Miner, n abi.SectorNumber) bool { return m.Recovering[n] })
+}
+
+func (h *handler) StateMarketStorageDeal(_ context.Context, id abi.DealID, tsk types.TipSetKey) (*api.MarketDeal, error) {
+	h.s.called("StateMarketStorageDeal")
+	if err := h.s.lookup(tsk); err != nil {
+		return nil, err
+	}
+	d, ok := h.s.chain.Deals[id]
+	if !ok {
+		return nil, fmt.Errorf("deal %d not found", id)
+	}
+	return d, nil
+}
+
+func (h *handler) StateMarketDeals(_ context.Context, tsk types.TipSetKey) (map[string]*api.MarketDeal, error) {
+	h.s.called("StateMarketDeals")
+	if err := h.s.lookup(tsk); err != nil {
+		return nil, err
+	}
+	deals := make(map[string]*api.MarketDeal, len(h.s.chain.Deals))
+	for id, d := range h.s.chain.Deals {
+		deals[fmt.Sprint(id)] = d
+	}
+	return deals, nil
+}
+
+func (h *handler) StateSectorGetInfo(_ context.Context, maddr address.Address, n abi.SectorNumber, tsk types.TipSetKey) (*miner.SectorOnChainInfo, error) {
+	h.s.called("StateSectorGetInfo")
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range m.Sectors {
+		if s.SectorNumber == n {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (h *handler) StateSectorPreCommitInfo(_ context.Context, maddr address.Address, n abi.SectorNumber, tsk types.TipSetKey) (*miner.SectorPreCommitOnChainInfo, error) {
+	h.s.called("StateSectorPreCommitInfo")
+	m, err := h.s.miner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	return m.PreCommits[n], nil
+}
+
+// Randomness is the fake draw for a tag, epoch and entropy, the same for
+// tickets and beacon.
+func Randomness(tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte) abi.Randomness {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, int64(tag))
+	binary.Write(h, binary.BigEndian, int64(epoch))
+	h.Write(entropy)
+	return h.Sum(nil)
+}
+
+func (h *handler) StateGetRandomnessFromTickets(_ context.Context, tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte, tsk types.TipSetKey) (abi.Randomness, error) {
+	h.s.called("StateGetRandomnessFromTickets")
+	return Randomness(tag, epoch, entropy), h.s.lookup(tsk)
+}
+
+func (h *handler) StateGetRandomnessFromBeacon(_ context.Context, tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte, tsk types.TipSetKey) (abi.Randomness, error) {
+	h.s.called("StateGetRandomnessFromBeacon")
+	return Randomness(tag, epoch, entropy), h.s.lookup(tsk)
+}
+
+// Sector returns a 32GiB cc sector, set the deal weights for other classes.
+func Sector(n abi.SectorNumber, activation, expiration abi.ChainEpoch, pledge abi.TokenAmount) *miner.SectorOnChainInfo {
+	return &miner.SectorOnChainInfo{
+		SectorNumber:       n,
+		SealProof:          abi.RegisteredSealProof_StackedDrg32GiBV1_1,
+		SealedCID:          placeholder,
+		Activation:         activation,
+		Expiration:         expiration,
+		DealWeight:         big.Zero(),
+		VerifiedDealWeight: big.Zero(),
+		InitialPledge:      pledge,
+		PowerBaseEpoch:     activation,
+		DailyFee:           big.Zero(),
+	}
+}
+
+// FIL is n whole fil in attofil.
+func FIL(n int64) abi.TokenAmount {
+	return big.Mul(big.NewInt(n), big.NewInt(1e18))
+}
@@ -0,0 +1,102 @@
+package lotustest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	market16 "github.com/filecoin-project/go-state-types/builtin/v16/market"
+	"github.com/filecoin-project/go-state-types/builtin/v16/util/adt"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// marketState writes a market actor state to the block store whose
+// ProviderSectors map holds the activated deals of Chain.Deals. The rest of
+// the state is empty.
+func (s *Server) marketState(ctx context.Context) (cid.Cid, error) {
+	s.blocksLk.Lock()
+	defer s.blocksLk.Unlock()
+	store := adt.WrapStore(ctx, cbor.NewCborStore(s.blocks))
+	st, err := market16.ConstructState(store)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	sectors := map[abi.ActorID]map[abi.SectorNumber]market16.SectorDealIDs{}
+	for id, d := range s.chain.Deals {
+		if d.State.SectorStartEpoch < 0 {
+			continue
+		}
+		provider, err := address.IDFromAddress(d.Proposal.Provider)
+		if err != nil {
+			return cid.Undef, err
+		}
+		p, ok := sectors[abi.ActorID(provider)]
+		if !ok {
+			p = map[abi.SectorNumber]market16.SectorDealIDs{}
+			sectors[abi.ActorID(provider)] = p
+		}
+		p[d.State.SectorNumber] = append(p[d.State.SectorNumber], id)
+	}
+
+	providers, err := adt.MakeEmptyMap(store, market16.ProviderSectorsHamtBitwidth)
+	if err != nil {
+		return cid.Undef, err
+	}
+	for provider, ps := range sectors {
+		m, err := adt.MakeEmptyMap(store, market16.ProviderSectorsHamtBitwidth)
+		if err != nil {
+			return cid.Undef, err
+		}
+		for n, ids := range ps {
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			if err := m.Put(abi.UIntKey(uint64(n)), &ids); err != nil {
+				return cid.Undef, err
+			}
+		}
+		root, err := m.Root()
+		if err != nil {
+			return cid.Undef, err
+		}
+		c := cbg.CborCid(root)
+		if err := providers.Put(abi.UIntKey(uint64(provider)), &c); err != nil {
+			return cid.Undef, err
+		}
+	}
+	if st.ProviderSectors, err = providers.Root(); err != nil {
+		return cid.Undef, err
+	}
+	return store.Put(ctx, st)
+}
+
+func (h *handler) StateGetActor(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	h.s.called("StateGetActor")
+	if err := h.s.lookup(tsk); err != nil {
+		return nil, err
+	}
+	if addr != builtin.StorageMarketActorAddr {
+		return nil, fmt.Errorf("actor not found")
+	}
+	head, err := h.s.marketState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Actor{Code: placeholder, Head: head, Balance: abi.NewTokenAmount(0)}, nil
+}
+
+func (h *handler) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
+	h.s.called("ChainReadObj")
+	h.s.blocksLk.Lock()
+	defer h.s.blocksLk.Unlock()
+	b, err := h.s.blocks.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return b.RawData(), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"check-sector-info/config"
+	"check-sector-info/migrations"
+	"check-sector-info/sqlexec"
+)
+
+var configPath = flag.String("config", "", "config file, defaults to $CSI_CONFIG or the first of "+strings.Join(config.SearchPaths(), ", ")+" that exists")
+var dsn = flag.String("d", "", "ops dsn, mysql://, postgres:// or sqlite://path, defaults to db.dsn of the config file")
+var to = flag.Int("to", -1, "version to migrate to, up defaults to the latest, down needs it given and stops at the baseline 1")
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] status|up|down\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("load config failed,%s", err)
+	}
+	if err := config.SetFlags(flag.CommandLine, map[string]string{"d": cfg.DB.DSN}); err != nil {
+		log.Fatalf("load config failed,%s", err)
+	}
+	if *dsn == "" {
+		log.Fatalf("no ops dsn, set -d, db.dsn in the config file or CSI_DSN")
+	}
+
+	ctx := context.Background()
+	db, dialect, err := sqlexec.InitDB(*dsn)
+	if err != nil {
+		log.Fatalf("init db failed,%s", err)
+	}
+	defer db.Close()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "status":
+		cur, err := migrations.Current(ctx, db)
+		if err != nil {
+			// schema_version is only created by the first up
+			log.Printf("%s", err)
+		}
+		for _, m := range migrations.All(dialect) {
+			state := "待执行"
+			if m.Version <= cur {
+				state = "已执行"
+			}
+			fmt.Printf("%04d %-24s %s\n", m.Version, m.Name, state)
+		}
+		fmt.Printf("当前版本 %d, 最新版本 %d\n", cur, migrations.Latest())
+	case "up":
+		target := *to
+		if target < 0 {
+			target = migrations.Latest()
+		}
+		done, err := migrations.Up(ctx, db, dialect, target)
+		for _, m := range done {
+			log.Printf("applied %04d %s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up failed,%s", err)
+		}
+		log.Printf("%d migrations applied", len(done))
+	case "down":
+		if *to < 0 {
+			log.Fatalf("down needs -to, the version to go back to, at least 1")
+		}
+		done, err := migrations.Down(ctx, db, dialect, *to)
+		for _, m := range done {
+			log.Printf("reverted %04d %s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate down failed,%s", err)
+		}
+		log.Printf("%d migrations reverted", len(done))
+	default:
+		fmt.Println("Error: unknown command " + cmd)
+		usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,281 @@
+// Package migrations keeps the schema of the ops db tables the tools write.
+// Each step is a pair of sql/<dialect>/NNNN_name.up.sql and .down.sql files,
+// every dialect has the same steps, and the versions applied are recorded in
+// schema_version. Step 1 is the baseline, the tables as they were before
+// migrations, and only has an up file: it may find them already in
+// production, so it is never reverted.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"check-sector-info/sqlexec"
+)
+
+//go:embed sql
+var files embed.FS
+
+var dialects = []sqlexec.Dialect{sqlexec.MySQL, sqlexec.Postgres, sqlexec.SQLite}
+
+var createVersionSQL = map[sqlexec.Dialect]string{
+	sqlexec.MySQL:    "CREATE TABLE IF NOT EXISTS schema_version (version INT NOT NULL PRIMARY KEY, name VARCHAR(128) NOT NULL, applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)",
+	sqlexec.Postgres: "CREATE TABLE IF NOT EXISTS schema_version (version INT NOT NULL PRIMARY KEY, name VARCHAR(128) NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)",
+	sqlexec.SQLite:   "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)",
+}
+
+const (
+	selectVersionSQL = "SELECT COALESCE(MAX(version), 0) FROM schema_version"
+	insertVersionSQL = "INSERT INTO schema_version(version, name) VALUES (?, ?)"
+	deleteVersionSQL = "DELETE FROM schema_version WHERE version = ?"
+)
+
+// ErrBehind is returned by Check when migrations are still to be applied.
+var ErrBehind = errors.New("schema is behind")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+var all = map[sqlexec.Dialect][]Migration{}
+
+func init() {
+	for _, d := range dialects {
+		ms, err := load(files, d)
+		if err != nil {
+			panic(fmt.Sprintf("%s migrations: %s", d, err))
+		}
+		if len(ms) != len(all[sqlexec.MySQL]) && d != sqlexec.MySQL {
+			panic(fmt.Sprintf("%d %s migrations, %d mysql", len(ms), d, len(all[sqlexec.MySQL])))
+		}
+		all[d] = ms
+	}
+}
+
+func load(fsys fs.FS, d sqlexec.Dialect) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "sql/"+string(d)+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, p := range names {
+		base := path.Base(p)
+		stem, dir, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		num, name, ok2 := strings.Cut(stem, "_")
+		v, err := strconv.Atoi(num)
+		if !ok || !ok2 || err != nil || v <= 0 || (dir != "up" && dir != "down") {
+			return nil, fmt.Errorf("migration file %s, want NNNN_name.up.sql or NNNN_name.down.sql", base)
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[v]
+		if m == nil {
+			m = &Migration{Version: v, Name: name}
+			byVersion[v] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d named both %s and %s", v, m.Name, name)
+		}
+		if dir == "up" {
+			m.Up = split(string(b))
+		} else {
+			m.Down = split(string(b))
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d missing", i+1)
+		}
+		switch {
+		case len(m.Up) == 0:
+			return nil, fmt.Errorf("migration %d has no up step", m.Version)
+		case m.Version == 1 && len(m.Down) != 0:
+			return nil, fmt.Errorf("migration 1 is the baseline and cannot have a down step")
+		case m.Version > 1 && len(m.Down) == 0:
+			return nil, fmt.Errorf("migration %d has no down step", m.Version)
+		}
+	}
+	return ms, nil
+}
+
+// split cuts a file into its statements, which end with ';' at the end of a
+// line. Lines starting with "--" are dropped.
+func split(s string) []string {
+	var stmts []string
+	var cur []string
+	for _, line := range strings.Split(s, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur = append(cur, trimmed)
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.Join(cur, " "), ";"))
+			cur = nil
+		}
+	}
+	if len(cur) != 0 {
+		stmts = append(stmts, strings.Join(cur, " "))
+	}
+	return stmts
+}
+
+// All returns the migrations of a dialect in version order.
+func All(d sqlexec.Dialect) []Migration {
+	return append([]Migration(nil), all[d]...)
+}
+
+// Latest is the version the tools are written for.
+func Latest() int {
+	ms := all[sqlexec.MySQL]
+	return ms[len(ms)-1].Version
+}
+
+func steps(d sqlexec.Dialect) ([]Migration, error) {
+	ms, ok := all[d]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for %q", d)
+	}
+	return ms, nil
+}
+
+// Current returns the version of the schema at db, 0 before any migration.
+func Current(ctx context.Context, db *sql.DB) (int, error) {
+	var v int
+	if err := db.QueryRowContext(ctx, selectVersionSQL).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema_version: %w", err)
+	}
+	return v, nil
+}
+
+// Check returns ErrBehind unless db is at Latest. A schema ahead of the tools
+// is refused too, it may have columns this build does not fill in.
+func Check(ctx context.Context, db *sql.DB) error {
+	v, err := Current(ctx, db)
+	if err != nil {
+		return fmt.Errorf("%w, run migrate up: %s", ErrBehind, err)
+	}
+	switch {
+	case v < Latest():
+		return fmt.Errorf("%w: version %d, want %d, run migrate up", ErrBehind, v, Latest())
+	case v > Latest():
+		return fmt.Errorf("schema version %d is newer than %d of this build", v, Latest())
+	}
+	return nil
+}
+
+// Up applies the migrations after the current version up to and including
+// to, and returns those applied. postgres and sqlite apply each step in a
+// transaction, mysql commits every DDL statement on its own, so there a
+// failed step is left half done and is not recorded.
+func Up(ctx context.Context, db *sql.DB, d sqlexec.Dialect, to int) ([]Migration, error) {
+	all, err := steps(d)
+	if err != nil {
+		return nil, err
+	}
+	if to < 0 || to > Latest() {
+		return nil, fmt.Errorf("no migration %d, latest is %d", to, Latest())
+	}
+	if _, err := db.ExecContext(ctx, createVersionSQL[d]); err != nil {
+		return nil, fmt.Errorf("create schema_version: %w", err)
+	}
+	cur, err := Current(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for v := cur + 1; v <= to; v++ {
+		m := all[v-1]
+		if err := apply(ctx, db, d, m.Up, insertVersionSQL, m.Version, m.Name); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down reverts the migrations after to, newest first, and returns those
+// reverted. to is at least 1, the baseline is not reverted.
+func Down(ctx context.Context, db *sql.DB, d sqlexec.Dialect, to int) ([]Migration, error) {
+	all, err := steps(d)
+	if err != nil {
+		return nil, err
+	}
+	if to < 1 {
+		return nil, fmt.Errorf("migration 1 is the baseline and cannot be reverted")
+	}
+	if to > Latest() {
+		return nil, fmt.Errorf("no migration %d, latest is %d", to, Latest())
+	}
+	cur, err := Current(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if cur > Latest() {
+		return nil, fmt.Errorf("schema version %d is newer than %d of this build", cur, Latest())
+	}
+
+	var done []Migration
+	for v := cur; v > to; v-- {
+		m := all[v-1]
+		if err := apply(ctx, db, d, m.Down, deleteVersionSQL, m.Version); err != nil {
+			return done, fmt.Errorf("revert migration %d %s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// apply runs the statements of one step and then record with args.
+func apply(ctx context.Context, db *sql.DB, d sqlexec.Dialect, stmts []string, record string, args ...any) (err error) {
+	type execer interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	}
+	var ex execer = db
+	if d != sqlexec.MySQL {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+			}
+		}()
+		ex = tx
+	}
+
+	for _, stmt := range stmts {
+		if _, err := ex.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := ex.ExecContext(ctx, d.Rebind(record), args...); err != nil {
+		return fmt.Errorf("record version: %w", err)
+	}
+	if tx, ok := ex.(*sql.Tx); ok {
+		return tx.Commit()
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/lotustest"
+	"check-sector-info/sqlexec"
+)
+
+func TestEmbedded(t *testing.T) {
+	for _, d := range dialects {
+		ms := All(d)
+		if len(ms) != Latest() {
+			t.Fatalf("%d %s migrations, latest %d", len(ms), d, Latest())
+		}
+		if len(ms[0].Down) != 0 {
+			t.Errorf("%s baseline has a down step", d)
+		}
+		for i, m := range ms {
+			if m.Name != All(sqlexec.MySQL)[i].Name {
+				t.Errorf("%s migration %d named %s", d, m.Version, m.Name)
+			}
+			for _, stmt := range append(m.Up, m.Down...) {
+				if strings.Contains(stmt, ";") || strings.Contains(stmt, "--") {
+					t.Errorf("%s migration %d statement not split: %q", d, m.Version, stmt)
+				}
+			}
+		}
+	}
+	if got := All(sqlexec.MySQL)[1].Up; len(got) != 1 || !strings.Contains(got[0], "ADD COLUMN od_count") {
+		t.Errorf("od columns migration = %q", got)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"gap": {
+			"sql/mysql/0001_a.up.sql": {Data: []byte("x;")}, "sql/mysql/0001_a.down.sql": {Data: []byte("x;")},
+			"sql/mysql/0003_c.up.sql": {Data: []byte("x;")}, "sql/mysql/0003_c.down.sql": {Data: []byte("x;")},
+		},
+		"no down": {
+			"sql/mysql/0001_a.up.sql": {Data: []byte("x;")},
+			"sql/mysql/0002_b.up.sql": {Data: []byte("x;")},
+		},
+		"baseline down": {"sql/mysql/0001_a.up.sql": {Data: []byte("x;")}, "sql/mysql/0001_a.down.sql": {Data: []byte("x;")}},
+		"no up":         {"sql/mysql/0001_a.down.sql": {Data: []byte("x;")}},
+		"bad name":      {"sql/mysql/one.up.sql": {Data: []byte("x;")}},
+		"renamed":       {"sql/mysql/0001_a.up.sql": {Data: []byte("x;")}, "sql/mysql/0001_b.down.sql": {Data: []byte("x;")}},
+	} {
+		if _, err := load(fsys, sqlexec.MySQL); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	dsn := lotustest.NewDB(t, nil)
+	db, err := sql.Open(lotustest.DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := Check(ctx, db); !errors.Is(err, ErrBehind) {
+		t.Fatalf("new database: Check = %v", err)
+	}
+	if done, err := Up(ctx, db, sqlexec.MySQL, 2); err != nil || len(done) != 2 {
+		t.Fatalf("Up(2) = %d, %v", len(done), err)
+	}
+	if err := Check(ctx, db); !errors.Is(err, ErrBehind) {
+		t.Fatalf("at 2: Check = %v", err)
+	}
+	if done, err := Up(ctx, db, sqlexec.MySQL, Latest()); err != nil || len(done) != Latest()-2 {
+		t.Fatalf("Up(latest) = %d, %v", len(done), err)
+	}
+	if err := Check(ctx, db); err != nil {
+		t.Fatalf("at latest: Check = %v", err)
+	}
+	// nothing left to apply
+	if done, err := Up(ctx, db, sqlexec.MySQL, Latest()); err != nil || len(done) != 0 {
+		t.Fatalf("Up again = %d, %v", len(done), err)
+	}
+
+	if done, err := Down(ctx, db, sqlexec.MySQL, 1); err != nil || len(done) != Latest()-1 || done[0].Version != Latest() {
+		t.Fatalf("Down(1) = %+v, %v", done, err)
+	}
+	if v, err := Current(ctx, db); err != nil || v != 1 {
+		t.Fatalf("Current = %d, %v", v, err)
+	}
+	if done, err := Up(ctx, db, sqlexec.MySQL, 0); err != nil || len(done) != 0 {
+		t.Fatalf("Up below current = %d, %v", len(done), err)
+	}
+	if _, err := Down(ctx, db, sqlexec.MySQL, 0); err == nil {
+		t.Fatal("baseline reverted")
+	}
+	if _, err := Up(ctx, db, sqlexec.MySQL, Latest()+1); err == nil {
+		t.Fatal("Up past latest accepted")
+	}
+
+	var ran []string
+	for _, s := range lotustest.Statements(t, dsn) {
+		if strings.Contains(s.Query, "filecoin_cluster_sector_expiration") {
+			ran = append(ran, strings.Fields(s.Query)[0])
+		}
+	}
+	if got, want := strings.Join(ran, " "), "CREATE ALTER ALTER ALTER ALTER"; got != want {
+		t.Errorf("ran %s, want %s", got, want)
+	}
+}
+
+func TestCheckAhead(t *testing.T) {
+	dsn := lotustest.NewDB(t, nil)
+	lotustest.SetSchemaVersion(t, dsn, Latest()+1)
+	db, err := sql.Open(lotustest.DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Check(context.Background(), db); err == nil || errors.Is(err, ErrBehind) {
+		t.Errorf("newer schema: Check = %v", err)
+	}
+}
+
+// TestSQLite runs the steps and the repository on a real sqlite file.
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, dialect, err := sqlexec.InitDB("sqlite://" + filepath.Join(t.TempDir(), "ops.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialect != sqlexec.SQLite {
+		t.Fatalf("dialect %s", dialect)
+	}
+	defer db.Close()
+
+	if _, err := Up(ctx, db, dialect, Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO cluster_list(name, f0) VALUES ('xc64', 'f01234')"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := sqlexec.NewRepository(ctx, db, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := repo.Miner(ctx, "xc64"); err != nil || m != "f01234" {
+		t.Fatalf("Miner = %q, %v", m, err)
+	}
+
+	const update = "2026-10-18 00:00:00"
+	pledge := decimal.RequireFromString("123.456789012345678901")
+	rows := []sqlexec.ExpirationRow{
+		{Name: "xc64", Miner: "f01234", Date: "2027-01-01", DCCount: 1, DCPledge: pledge, CCPledge: decimal.Zero, ODCount: 2, ODPledge: decimal.New(3, 0), UpdateDate: update},
+		{Name: "xc64", Miner: "f01234", Date: "2027-01-02", CCCount: 4, DCPledge: decimal.Zero, CCPledge: pledge, ODPledge: decimal.Zero, UpdateDate: update},
+	}
+	for range 2 {
+		if err := repo.ReplaceExpirations(ctx, "f01234", update, rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the unique key refuses a day twice and the snapshot is kept
+	if err := repo.ReplaceExpirations(ctx, "f01234", update, append(rows, rows[0])); err == nil {
+		t.Fatal("duplicate day written")
+	}
+
+	got, err := repo.Expirations(ctx, "f01234", update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("read %+v", got)
+	}
+	for i := range got {
+		w := rows[i]
+		g := got[i]
+		if g.Date != w.Date || g.UpdateDate != update || g.DCCount != w.DCCount || g.CCCount != w.CCCount || g.ODCount != w.ODCount ||
+			!g.DCPledge.Equal(w.DCPledge) || !g.CCPledge.Equal(w.CCPledge) || !g.ODPledge.Equal(w.ODPledge) {
+			t.Errorf("row %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	if _, err := Down(ctx, db, dialect, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(ctx, db, dialect, Latest()); err != nil {
+		t.Fatal(err)
+	}
+	// the baseline tables and their rows outlive a full revert
+	if _, err := Down(ctx, db, dialect, 0); err == nil {
+		t.Fatal("baseline reverted")
+	}
+	if m, err := repo.Miner(ctx, "xc64"); err != nil || m != "f01234" {
+		t.Fatalf("after down, Miner = %q, %v", m, err)
+	}
+}
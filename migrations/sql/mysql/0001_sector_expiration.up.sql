@@ -0,0 +1,12 @@
+-- the table as daily-script has been writing it, created only on a new database
+CREATE TABLE IF NOT EXISTS filecoin_cluster_sector_expiration (
+	name        VARCHAR(64)    NOT NULL,
+	miner       VARCHAR(32)    NOT NULL,
+	date        DATE           NOT NULL,
+	dc_count    INT            NOT NULL DEFAULT 0,
+	dc_pledge   DECIMAL(38,18) NOT NULL DEFAULT 0,
+	cc_count    INT            NOT NULL DEFAULT 0,
+	cc_pledge   DECIMAL(38,18) NOT NULL DEFAULT 0,
+	update_date DATETIME       NOT NULL,
+	KEY idx_miner_update_date (miner, update_date)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE filecoin_cluster_sector_expiration
+	DROP COLUMN od_pledge,
+	DROP COLUMN od_count;
@@ -0,0 +1,3 @@
+ALTER TABLE filecoin_cluster_sector_expiration
+	ADD COLUMN od_count  INT            NOT NULL DEFAULT 0 AFTER cc_pledge,
+	ADD COLUMN od_pledge DECIMAL(38,18) NOT NULL DEFAULT 0 AFTER od_count;
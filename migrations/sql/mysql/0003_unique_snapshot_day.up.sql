@@ -0,0 +1,3 @@
+-- fails while a snapshot still has the same day twice, remove those rows first
+ALTER TABLE filecoin_cluster_sector_expiration
+	ADD UNIQUE KEY uk_miner_date_update_date (miner, date, update_date);
@@ -0,0 +1,18 @@
+-- every sector of a cluster as daily-script saw it on update_date, written
+-- with -sectors and pruned after -sector-retention days
+CREATE TABLE IF NOT EXISTS filecoin_cluster_sector_snapshot (
+	name            VARCHAR(64)    NOT NULL,
+	miner           VARCHAR(32)    NOT NULL,
+	update_date     DATETIME       NOT NULL,
+	sector_number   BIGINT         NOT NULL,
+	class           VARCHAR(16)    NOT NULL,
+	activation      BIGINT         NOT NULL,
+	expiration      BIGINT         NOT NULL,
+	expiration_date DATE           NOT NULL,
+	initial_pledge  DECIMAL(38,18) NOT NULL,
+	deal_ids        TEXT           NOT NULL,
+	seal_proof      INT            NOT NULL,
+	sector_key_cid  VARCHAR(128)   NULL,
+	PRIMARY KEY (miner, update_date, sector_number),
+	KEY idx_update_date (update_date)
+);
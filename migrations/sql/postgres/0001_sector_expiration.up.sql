@@ -0,0 +1,16 @@
+-- a local database has no ops tables, cluster_list is created here as well
+CREATE TABLE IF NOT EXISTS cluster_list (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	f0   VARCHAR(32) NOT NULL
+);
+CREATE TABLE IF NOT EXISTS filecoin_cluster_sector_expiration (
+	name        VARCHAR(64)    NOT NULL,
+	miner       VARCHAR(32)    NOT NULL,
+	date        DATE           NOT NULL,
+	dc_count    INT            NOT NULL DEFAULT 0,
+	dc_pledge   NUMERIC(38,18) NOT NULL DEFAULT 0,
+	cc_count    INT            NOT NULL DEFAULT 0,
+	cc_pledge   NUMERIC(38,18) NOT NULL DEFAULT 0,
+	update_date TIMESTAMP      NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_miner_update_date ON filecoin_cluster_sector_expiration (miner, update_date);
@@ -0,0 +1,3 @@
+ALTER TABLE filecoin_cluster_sector_expiration
+	ADD COLUMN od_count  INT            NOT NULL DEFAULT 0,
+	ADD COLUMN od_pledge NUMERIC(38,18) NOT NULL DEFAULT 0;
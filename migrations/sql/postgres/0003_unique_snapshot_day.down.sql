@@ -0,0 +1,2 @@
+ALTER TABLE filecoin_cluster_sector_expiration
+	DROP CONSTRAINT uk_miner_date_update_date;
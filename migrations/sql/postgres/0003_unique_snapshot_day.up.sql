@@ -0,0 +1,2 @@
+ALTER TABLE filecoin_cluster_sector_expiration
+	ADD CONSTRAINT uk_miner_date_update_date UNIQUE (miner, date, update_date);
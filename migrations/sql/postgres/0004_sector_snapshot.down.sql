@@ -0,0 +1 @@
+DROP TABLE IF EXISTS filecoin_cluster_sector_snapshot;
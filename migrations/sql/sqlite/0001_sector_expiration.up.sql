@@ -0,0 +1,17 @@
+-- a local database has no ops tables, cluster_list is created here as well.
+-- pledges are TEXT, sqlite would round a DECIMAL to a float
+CREATE TABLE IF NOT EXISTS cluster_list (
+	name TEXT NOT NULL PRIMARY KEY,
+	f0   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS filecoin_cluster_sector_expiration (
+	name        TEXT    NOT NULL,
+	miner       TEXT    NOT NULL,
+	date        DATE    NOT NULL,
+	dc_count    INTEGER NOT NULL DEFAULT 0,
+	dc_pledge   TEXT    NOT NULL DEFAULT '0',
+	cc_count    INTEGER NOT NULL DEFAULT 0,
+	cc_pledge   TEXT    NOT NULL DEFAULT '0',
+	update_date DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_miner_update_date ON filecoin_cluster_sector_expiration (miner, update_date);
@@ -0,0 +1,2 @@
+ALTER TABLE filecoin_cluster_sector_expiration DROP COLUMN od_pledge;
+ALTER TABLE filecoin_cluster_sector_expiration DROP COLUMN od_count;
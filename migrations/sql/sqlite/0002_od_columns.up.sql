@@ -0,0 +1,2 @@
+ALTER TABLE filecoin_cluster_sector_expiration ADD COLUMN od_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE filecoin_cluster_sector_expiration ADD COLUMN od_pledge TEXT NOT NULL DEFAULT '0';
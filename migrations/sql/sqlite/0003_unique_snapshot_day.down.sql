@@ -0,0 +1 @@
+DROP INDEX uk_miner_date_update_date;
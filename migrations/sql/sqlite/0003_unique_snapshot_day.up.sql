@@ -0,0 +1 @@
+CREATE UNIQUE INDEX uk_miner_date_update_date ON filecoin_cluster_sector_expiration (miner, date, update_date);
@@ -0,0 +1,18 @@
+-- every sector of a cluster as daily-script saw it on update_date, written
+-- with -sectors and pruned after -sector-retention days
+CREATE TABLE IF NOT EXISTS filecoin_cluster_sector_snapshot (
+	name            TEXT     NOT NULL,
+	miner           TEXT     NOT NULL,
+	update_date     DATETIME NOT NULL,
+	sector_number   INTEGER  NOT NULL,
+	class           TEXT     NOT NULL,
+	activation      INTEGER  NOT NULL,
+	expiration      INTEGER  NOT NULL,
+	expiration_date DATE     NOT NULL,
+	initial_pledge  TEXT     NOT NULL,
+	deal_ids        TEXT     NOT NULL,
+	seal_proof      INTEGER  NOT NULL,
+	sector_key_cid  TEXT     NULL,
+	PRIMARY KEY (miner, update_date, sector_number)
+);
+CREATE INDEX IF NOT EXISTS idx_sector_snapshot_update_date ON filecoin_cluster_sector_snapshot (update_date);
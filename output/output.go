@@ -0,0 +1,91 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Format string
+
+const (
+	Text   Format = "text"
+	JSON   Format = "json"
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case Text, JSON, CSV, NDJSON:
+		return f, nil
+	case "":
+		return Text, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, must be one of text, json, csv, ndjson", s)
+	}
+}
+
+// Table is one CSV section. Sections are separated by an empty line so
+// that several record shapes can share one output stream.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+func WriteJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// WriteNDJSON writes v as a single line with an extra "kind" field so that
+// consumers can tell the record types apart.
+func WriteNDJSON(w io.Writer, kind string, v interface{}) error {
+	return WriteNDJSONTagged(w, kind, nil, v)
+}
+
+// WriteNDJSONTagged is WriteNDJSON with extra string fields added to the
+// record, e.g. the miner when records of several miners share a stream.
+func WriteNDJSONTagged(w io.Writer, kind string, tags map[string]string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return fmt.Errorf("%s record is not a json object: %w", kind, err)
+	}
+
+	for name, value := range tags {
+		fields[name], _ = json.Marshal(value)
+	}
+	k, _ := json.Marshal(kind)
+	fields["kind"] = k
+
+	return json.NewEncoder(w).Encode(fields)
+}
+
+func WriteCSV(w io.Writer, tables ...Table) error {
+	cw := csv.NewWriter(w)
+	for i, t := range tables {
+		if i > 0 {
+			cw.Flush()
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+
+		if err := cw.Write(t.Header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.Rows); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
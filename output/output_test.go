@@ -0,0 +1,99 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for s, want := range map[string]Format{"": Text, "text": Text, " JSON ": JSON, "csv": CSV, "NdJson": NDJSON} {
+		if f, err := ParseFormat(s); err != nil || f != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", s, f, err, want)
+		}
+	}
+	for _, s := range []string{"xml", "json,csv", "tsv"} {
+		if f, err := ParseFormat(s); err == nil {
+			t.Errorf("ParseFormat(%q) = %q", s, f)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteCSV(&b,
+		Table{Header: []string{"miner", "note"}, Rows: [][]string{{"f01234", "a, b"}, {"f01235", "two\nlines"}}},
+		Table{Header: []string{"date", "count"}, Rows: [][]string{{"2024-07-18", "2"}, {"2024-09-25", "1"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "miner,note\n" +
+		"f01234,\"a, b\"\n" +
+		"f01235,\"two\nlines\"\n" +
+		"\n" +
+		"date,count\n" +
+		"2024-07-18,2\n" +
+		"2024-09-25,1\n"
+	if b.String() != want {
+		t.Fatalf("csv\n%q\nwant\n%q", b.String(), want)
+	}
+
+	// the quoted fields read back unchanged
+	first, _, _ := strings.Cut(b.String(), "\n\n")
+	records, err := csv.NewReader(strings.NewReader(first)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[1][1] != "a, b" || records[2][1] != "two\nlines" {
+		t.Errorf("read back %q", records)
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	type row struct {
+		Date  string `json:"date"`
+		Count int    `json:"count"`
+	}
+	var b bytes.Buffer
+	if err := WriteNDJSONTagged(&b, "day", map[string]string{"miner": "f01234"}, row{"2024-07-18", 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteNDJSON(&b, "total", row{Count: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteNDJSON(&b, "list", []int{1}); err == nil {
+		t.Error("non object record written")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []map[string]any{
+		{"kind": "day", "miner": "f01234", "date": "2024-07-18", "count": 2.0},
+		{"kind": "total", "date": "", "count": 3.0},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("%d lines, want %d:\n%s", len(lines), len(want), b.String())
+	}
+	for i, line := range lines {
+		var got map[string]any
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d %q: %s", i, line, err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJSON(&b, map[string]int{"count": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "{\n\t\"count\": 2\n}\n" {
+		t.Errorf("json %q", b.String())
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/dealcache"
+	"check-sector-info/extension"
+	"check-sector-info/lotusclient"
+	"check-sector-info/output"
+	"check-sector-info/sectorstatus"
+	timeToHeight "check-sector-info/time-height"
+)
+
+type PlanBatch struct {
+	Index        int             `json:"index"`
+	Declarations int             `json:"declarations"`
+	Sectors      int             `json:"sectors"`
+	PledgeDays   decimal.Decimal `json:"pledge_days"`
+	ParamsFile   string          `json:"params_file"`
+	HexFile      string          `json:"hex_file"`
+}
+
+type ExtendPlan struct {
+	Miner      string           `json:"miner"`
+	Target     abi.ChainEpoch   `json:"target"`
+	TargetTime time.Time        `json:"target_time"`
+	Limits     extension.Limits `json:"limits"`
+	Sectors    int              `json:"sectors"`
+	PledgeDays decimal.Decimal  `json:"pledge_days"`
+	Skipped    map[string]int   `json:"skipped"`
+	Batches    []PlanBatch      `json:"batches"`
+}
+
+// parseTarget accepts a -d style dateTime or +N days, optionally suffixed
+// with d, counted from epoch.
+func parseTarget(s string, epoch abi.ChainEpoch) (abi.ChainEpoch, error) {
+	if strings.HasPrefix(s, "+") {
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(s, "+"), "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return epoch + abi.ChainEpoch(days)*builtin.EpochsInDay, nil
+	}
+
+	t, err := timeToHeight.StrToTime(s)
+	if err != nil {
+		return 0, err
+	}
+	return timeToHeight.TimeToHeight(t), nil
+}
+
+func planExtend(ctx context.Context, delegate lotusclient.Node, addr address.Address, tsk types.TipSetKey,
+	sectors []*miner.SectorOnChainInfo, deals *dealcache.Cache, f output.Format) {
+	pol, err := extension.LoadPolicy(ctx, delegate, tsk)
+	if err != nil {
+		log.Fatalf("failed to load extension policy,err:%s", err)
+	}
+	limits, err := pol.Limits()
+	if err != nil {
+		log.Fatalf("failed to get message limits,err:%s", err)
+	}
+	target, err := parseTarget(*extendTo, pol.Epoch)
+	if err != nil {
+		log.Fatalf("invalid -to %q,err:%s", *extendTo, err)
+	}
+	claims, err := extension.LoadClaims(ctx, delegate, addr, tsk)
+	if err != nil {
+		log.Fatalf("failed to get miner claims,err:%s", err)
+	}
+	partitions, err := sectorstatus.LoadPartitions(ctx, delegate, addr, tsk)
+	if err != nil {
+		log.Fatalf("failed to get miner partitions,err:%s", err)
+	}
+
+	plan := ExtendPlan{
+		Miner:      addr.String(),
+		Target:     target,
+		TargetTime: timeToHeight.HeightToTime(target),
+		Limits:     limits,
+		PledgeDays: decimal.Zero,
+		Skipped:    map[string]int{},
+	}
+
+	var cands []extension.Candidate
+	for _, sector := range sectors {
+		e := pol.Evaluate(sector, claims[sector.SectorNumber], lookupDeals(ctx, deals, sector))
+		if !e.Extendable {
+			plan.Skipped[e.Reason]++
+			continue
+		}
+
+		newExp, reason := pol.NewExpiration(sector, e, target)
+		if reason != "" {
+			plan.Skipped[reason]++
+			continue
+		}
+
+		dl, part, ok := partitions.Location(sector.SectorNumber)
+		if !ok {
+			plan.Skipped["not found in any partition"]++
+			continue
+		}
+
+		cands = append(cands, extension.Candidate{
+			Sector:        sector,
+			Location:      extension.Location{Deadline: dl, Partition: part},
+			NewExpiration: newExp,
+			Claims:        claims[sector.SectorNumber],
+		})
+	}
+
+	batches, err := extension.BuildBatches(cands, limits)
+	if err != nil {
+		log.Fatalf("failed to build extension batches,err:%s", err)
+	}
+
+	if err := os.MkdirAll(*planDir, 0755); err != nil {
+		log.Fatalf("failed to create plan dir,err:%s", err)
+	}
+	for i, b := range batches {
+		pb := PlanBatch{
+			Index:        i,
+			Declarations: len(b.Params.Extensions),
+			Sectors:      b.Sectors,
+			PledgeDays:   b.PledgeDays,
+			ParamsFile:   filepath.Join(*planDir, fmt.Sprintf("%s-extend-%d.json", addr, i)),
+			HexFile:      filepath.Join(*planDir, fmt.Sprintf("%s-extend-%d.hex", addr, i)),
+		}
+
+		pf, err := os.Create(pb.ParamsFile)
+		if err != nil {
+			log.Fatalf("failed to create params file,err:%s", err)
+		}
+		err = output.WriteJSON(pf, b.Params)
+		pf.Close()
+		if err != nil {
+			log.Fatalf("failed to write params file,err:%s", err)
+		}
+		if err := os.WriteFile(pb.HexFile, []byte(b.ParamsHex+"\n"), 0644); err != nil {
+			log.Fatalf("failed to write hex file,err:%s", err)
+		}
+
+		plan.Sectors += b.Sectors
+		plan.PledgeDays = plan.PledgeDays.Add(b.PledgeDays)
+		plan.Batches = append(plan.Batches, pb)
+	}
+
+	if err := plan.Write(os.Stdout, f); err != nil {
+		log.Fatalf("write plan failed,err:%s", err)
+	}
+}
+
+func (p ExtendPlan) Write(w io.Writer, f output.Format) error {
+	switch f {
+	case output.JSON:
+		return output.WriteJSON(w, p)
+	case output.NDJSON:
+		for _, b := range p.Batches {
+			if err := output.WriteNDJSON(w, "batch", b); err != nil {
+				return err
+			}
+		}
+		summary := p
+		summary.Batches = nil
+		return output.WriteNDJSON(w, "plan", summary)
+	case output.CSV:
+		t := output.Table{Header: []string{"index", "declarations", "sectors", "pledge_days", "params_file", "hex_file"}}
+		for _, b := range p.Batches {
+			t.Rows = append(t.Rows, []string{
+				strconv.Itoa(b.Index),
+				strconv.Itoa(b.Declarations),
+				strconv.Itoa(b.Sectors),
+				b.PledgeDays.String(),
+				b.ParamsFile,
+				b.HexFile,
+			})
+		}
+		return output.WriteCSV(w, t)
+	default:
+		fmt.Fprintf(w, "miner: %s,目标到期高度：%d(%s)\n", p.Miner, p.Target, p.TargetTime)
+		for _, b := range p.Batches {
+			fmt.Fprintf(w, "batch %d: %d个声明，sector %d个，质押天数：%s Fil·天，params：%s\n",
+				b.Index, b.Declarations, b.Sectors, b.PledgeDays.StringFixed(4), b.ParamsFile)
+		}
+		reasons := make([]string, 0, len(p.Skipped))
+		for r := range p.Skipped {
+			reasons = append(reasons, r)
+		}
+		sort.Strings(reasons)
+		for _, r := range reasons {
+			fmt.Fprintf(w, "跳过 %d个：%s\n", p.Skipped[r], r)
+		}
+		fmt.Fprintln(w, "==============续期总览===============")
+		fmt.Fprintf(w, "共计sector \t%d个，消息 %d条，质押天数：%s Fil·天\n", p.Sectors, len(p.Batches), p.PledgeDays.StringFixed(4))
+		return nil
+	}
+}
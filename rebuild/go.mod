@@ -3,6 +3,7 @@ module rebuild
 go 1.21.8
 
 require (
+	check-sector-info/config v0.0.0
 	github.com/filecoin-project/go-address v1.1.0
 	github.com/filecoin-project/go-fil-commcid v0.1.0
 	github.com/filecoin-project/go-jsonrpc v0.3.1
@@ -134,3 +135,5 @@ require (
 )
 
 replace github.com/filecoin-project/go-jsonrpc => github.com/ipfs-force-community/go-jsonrpc v0.1.7-0.20230220074347-8db78dbc20d4
+
+replace check-sector-info/config => ../config
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"check-sector-info/config"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// rpcPath is the version path ParseAPIInfo puts on urls, the venus dialer
+// appends its own.
+var rpcPath = regexp.MustCompile(`/rpc/v[0-9]+/?$`)
+
+// ApplyConfig sets --chain and --token from lotus.url and lotus.token of
+// check-sector-info.yaml, found and overridden like config.Load does, unless
+// they were given as flags or through CHAIN and TOKEN. Only the first of
+// several lotus.url endpoints is used.
+func ApplyConfig(cctx *cli.Context) error {
+	c, err := config.Load(cctx.String("config"))
+	if err != nil {
+		return err
+	}
+
+	if entry, _, _ := strings.Cut(c.Lotus.URL, ","); strings.TrimSpace(entry) != "" {
+		chain, token, err := ParseEndpoint(entry)
+		if err != nil {
+			return fmt.Errorf("lotus.url: %w", err)
+		}
+		if !cctx.IsSet("chain") {
+			if err := cctx.Set("chain", chain); err != nil {
+				return err
+			}
+		}
+		if c.Lotus.Token == "" {
+			c.Lotus.Token = token
+		}
+	}
+	if !cctx.IsSet("token") && c.Lotus.Token != "" {
+		if err := cctx.Set("token", c.Lotus.Token); err != nil {
+			return err
+		}
+	}
+
+	if cctx.String("chain") == "" {
+		return fmt.Errorf("no chain endpoint, set --chain, CHAIN or lotus.url in the config file")
+	}
+	return nil
+}
+
+// ParseEndpoint turns a lotus.url entry into the base url --chain expects
+// and the token it carries, if any.
+func ParseEndpoint(entry string) (string, string, error) {
+	token, url, err := config.ParseAPIInfo(strings.TrimSpace(entry))
+	if err != nil {
+		return "", "", err
+	}
+	return rpcPath.ReplaceAllString(url, "/"), token, nil
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	for _, c := range []struct {
+		entry, chain, token string
+	}{
+		{"http://127.0.0.1:3453/", "http://127.0.0.1:3453/", ""},
+		{"ws://127.0.0.1:1234/rpc/v1", "ws://127.0.0.1:1234/", ""},
+		{" https://node.example/rpc/v0/ ", "https://node.example/", ""},
+		{"/ip4/127.0.0.1/tcp/1234/http", "ws://127.0.0.1:1234/", ""},
+		{"/ip4/127.0.0.1/tcp/1234", "ws://127.0.0.1:1234/", ""},
+		{"/dns/node.example/tcp/443/wss", "wss://node.example:443/", ""},
+		{"eyJh.eyJB.c2ln:/ip4/10.0.0.1/tcp/1234/http", "ws://10.0.0.1:1234/", "eyJh.eyJB.c2ln"},
+	} {
+		chain, token, err := ParseEndpoint(c.entry)
+		if err != nil || chain != c.chain || token != c.token {
+			t.Errorf("%q = %q, %q, %v, want %q, %q", c.entry, chain, token, err, c.chain, c.token)
+		}
+	}
+	for _, entry := range []string{"127.0.0.1:1234", "node:1234", "ws://"} {
+		if chain, _, err := ParseEndpoint(entry); err == nil {
+			t.Errorf("%q accepted as %q", entry, chain)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	t.Setenv("CSI_CONFIG", "")
+	t.Setenv("CSI_LOTUS_URL", "")
+	t.Setenv("CSI_LOTUS_TOKEN", "")
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	apply := func(args ...string) (string, string, error) {
+		var chain, token string
+		app := &cli.App{
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "config"},
+				&cli.StringFlag{Name: "chain", Value: "http://127.0.0.1:3453/"},
+				&cli.StringFlag{Name: "token"},
+			},
+			Before: ApplyConfig,
+			Action: func(cctx *cli.Context) error {
+				chain, token = cctx.String("chain"), cctx.String("token")
+				return nil
+			},
+		}
+		err := app.Run(append([]string{"rebuild"}, args...))
+		return chain, token, err
+	}
+
+	multiaddr := write("multiaddr.yaml", "lotus:\n  url: eyJh.eyJB.c2ln:/ip4/10.0.0.1/tcp/1234/http, ws://10.0.0.2:1234/rpc/v1\n")
+	explicit := write("explicit.yaml", "lotus:\n  url: eyJh.eyJB.c2ln:/ip4/10.0.0.1/tcp/1234/http\n  token: own\n")
+	empty := write("empty.yaml", "")
+	bad := write("bad.yaml", "lotus:\n  url: 10.0.0.1:1234\n")
+
+	for _, c := range []struct {
+		name         string
+		args         []string
+		chain, token string
+	}{
+		{"token:multiaddr", []string{"--config", multiaddr}, "ws://10.0.0.1:1234/", "eyJh.eyJB.c2ln"},
+		{"flags win", []string{"--config", multiaddr, "--chain", "http://10.0.0.3:3453/", "--token", "flag"}, "http://10.0.0.3:3453/", "flag"},
+		{"lotus.token wins", []string{"--config", explicit}, "ws://10.0.0.1:1234/", "own"},
+		{"default", []string{"--config", empty}, "http://127.0.0.1:3453/", ""},
+	} {
+		chain, token, err := apply(c.args...)
+		if err != nil || chain != c.chain || token != c.token {
+			t.Errorf("%s: %q, %q, %v, want %q, %q", c.name, chain, token, err, c.chain, c.token)
+		}
+	}
+	if _, _, err := apply("--config", bad); err == nil {
+		t.Error("bad lotus.url accepted")
+	}
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin/v9/market"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/venus/venus-shared/actors/policy"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+)
+
+// fakeChain serves the calls of the info command from fixed state. Its
+// randomness is a hash of the draw so that tests can recompute it.
+type fakeChain struct {
+	head      abi.ChainEpoch
+	sector    *types.SectorOnChainInfo
+	precommit *types.SectorPreCommitOnChainInfo
+	deals     map[abi.DealID]*types.MarketDeal
+
+	// tipsets asked for by key, to check which state was read
+	keys map[string]abi.ChainEpoch
+	// precommitAt is the height StateSectorPreCommitInfo was asked at
+	precommitAt abi.ChainEpoch
+}
+
+func (c *fakeChain) tipset(h abi.ChainEpoch) (*types.TipSet, error) {
+	placeholder, _ := cid.Parse("bafkqaaa")
+	maddr, _ := address.NewIDAddress(1000)
+	ts, err := types.NewTipSet([]*types.BlockHeader{{
+		Miner:                 maddr,
+		Ticket:                &types.Ticket{VRFProof: binary.BigEndian.AppendUint64(nil, uint64(h))},
+		ElectionProof:         &types.ElectionProof{},
+		Parents:               []cid.Cid{placeholder},
+		ParentWeight:          big.Zero(),
+		Height:                h,
+		ParentStateRoot:       placeholder,
+		ParentMessageReceipts: placeholder,
+		Messages:              placeholder,
+		ParentBaseFee:         big.NewInt(100),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	c.keys[ts.Key().String()] = h
+	return ts, nil
+}
+
+func (c *fakeChain) height(tsk types.TipSetKey) (abi.ChainEpoch, error) {
+	if tsk.IsEmpty() {
+		return c.head, nil
+	}
+	h, ok := c.keys[tsk.String()]
+	if !ok {
+		return 0, fmt.Errorf("tipset %s not found", tsk)
+	}
+	return h, nil
+}
+
+func (c *fakeChain) ChainHead(context.Context) (*types.TipSet, error) {
+	return c.tipset(c.head)
+}
+
+func (c *fakeChain) ChainGetTipSetByHeight(_ context.Context, h abi.ChainEpoch, _ types.TipSetKey) (*types.TipSet, error) {
+	return c.tipset(h)
+}
+
+func (c *fakeChain) StateSectorGetInfo(_ context.Context, _ address.Address, n abi.SectorNumber, _ types.TipSetKey) (*types.SectorOnChainInfo, error) {
+	if n != c.sector.SectorNumber {
+		return nil, nil
+	}
+	return c.sector, nil
+}
+
+func (c *fakeChain) StateSectorPreCommitInfo(_ context.Context, _ address.Address, n abi.SectorNumber, tsk types.TipSetKey) (*types.SectorPreCommitOnChainInfo, error) {
+	h, err := c.height(tsk)
+	if err != nil {
+		return nil, err
+	}
+	c.precommitAt = h
+	if n != c.precommit.Info.SectorNumber {
+		return nil, nil
+	}
+	return c.precommit, nil
+}
+
+func (c *fakeChain) StateMarketStorageDeal(_ context.Context, id abi.DealID, _ types.TipSetKey) (*types.MarketDeal, error) {
+	d, ok := c.deals[id]
+	if !ok {
+		return nil, fmt.Errorf("deal %d not found", id)
+	}
+	return d, nil
+}
+
+func draw(tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte) abi.Randomness {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, int64(tag))
+	binary.Write(h, binary.BigEndian, int64(epoch))
+	h.Write(entropy)
+	return h.Sum(nil)
+}
+
+func (c *fakeChain) StateGetRandomnessFromTickets(_ context.Context, tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte, tsk types.TipSetKey) (abi.Randomness, error) {
+	_, err := c.height(tsk)
+	return draw(tag, epoch, entropy), err
+}
+
+func (c *fakeChain) StateGetRandomnessFromBeacon(_ context.Context, tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte, tsk types.TipSetKey) (abi.Randomness, error) {
+	_, err := c.height(tsk)
+	return draw(tag, epoch, entropy), err
+}
+
+func serve(t *testing.T, c *fakeChain) string {
+	rpc := jsonrpc.NewServer()
+	rpc.Register("Filecoin", c)
+	srv := httptest.NewServer(rpc)
+	t.Cleanup(srv.Close)
+	return srv.URL + "/rpc/v1"
+}
+
+func runInfo(t *testing.T, chain string, args ...string) RebuildInfo {
+	t.Helper()
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "chain"},
+			&cli.StringFlag{Name: "token"},
+		},
+		Commands: []*cli.Command{RebuildInfoCmd},
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	runErr := app.Run(append([]string{"rebuild-tool", "--chain", chain, "info"}, args...))
+	os.Stdout = stdout
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr != nil {
+		t.Fatalf("info %v: %s", args, runErr)
+	}
+
+	var ri RebuildInfo
+	if err := json.Unmarshal(out, &ri); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	return ri
+}
+
+func testChain(t *testing.T) (*fakeChain, [32]byte, cid.Cid) {
+	var commR, commD [32]byte
+	copy(commR[:], bytes.Repeat([]byte{1}, 32))
+	copy(commD[:], bytes.Repeat([]byte{2}, 32))
+	sealed, err := commcid.ReplicaCommitmentV1ToCID(commR[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	piece, err := commcid.DataCommitmentV1ToCID(commD[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := address.NewIDAddress(2000)
+	provider, _ := address.NewIDAddress(1234)
+	label, err := market.NewLabelFromString("piece")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &fakeChain{
+		head: 4000000,
+		keys: map[string]abi.ChainEpoch{},
+		sector: &types.SectorOnChainInfo{
+			SectorNumber:       7,
+			SealProof:          abi.RegisteredSealProof_StackedDrg32GiBV1_1,
+			SealedCID:          sealed,
+			DealIDs:            []abi.DealID{42},
+			Activation:         3000000,
+			Expiration:         4500000,
+			DealWeight:         big.Zero(),
+			VerifiedDealWeight: big.Zero(),
+			InitialPledge:      big.Zero(),
+		},
+		precommit: &types.SectorPreCommitOnChainInfo{
+			PreCommitDeposit: big.Zero(),
+			PreCommitEpoch:   2999000,
+		},
+		deals: map[abi.DealID]*types.MarketDeal{
+			42: {Proposal: types.DealProposal{
+				PieceCID:             piece,
+				PieceSize:            32 << 30,
+				Client:               client,
+				Provider:             provider,
+				Label:                label,
+				StartEpoch:           3000000,
+				EndEpoch:             4500000,
+				StoragePricePerEpoch: big.Zero(),
+				ProviderCollateral:   big.Zero(),
+				ClientCollateral:     big.Zero(),
+			}},
+		},
+	}
+	c.precommit.Info.SealProof = abi.RegisteredSealProof_StackedDrg32GiBV1_1
+	c.precommit.Info.SectorNumber = 7
+	c.precommit.Info.SealedCID = sealed
+	c.precommit.Info.SealRandEpoch = 2998000
+	c.precommit.Info.Expiration = 4500000
+	return c, commR, piece
+}
+
+func TestRebuildInfo(t *testing.T) {
+	chain, commR, piece := testChain(t)
+	ri := runInfo(t, serve(t, chain), "1234", "7")
+
+	var entropy bytes.Buffer
+	maddr, _ := address.NewIDAddress(1234)
+	if err := maddr.MarshalCBOR(&entropy); err != nil {
+		t.Fatal(err)
+	}
+
+	if ri.IsSnapUp || ri.SnapUpPublic.CommR != commR || ri.SnapUpPublic.Expiration != 4500000 {
+		t.Errorf("public info = %+v", ri.SnapUpPublic)
+	}
+	if ri.Ticket.Epoch != 2998000 || !bytes.Equal(ri.Ticket.Ticket, draw(crypto.DomainSeparationTag_SealRandomness, 2998000, entropy.Bytes())) {
+		t.Errorf("ticket = %+v", ri.Ticket)
+	}
+	seedEpoch := 2999000 + policy.GetPreCommitChallengeDelay()
+	if ri.Seed.Epoch != seedEpoch || !bytes.Equal(ri.Seed.Seed, draw(crypto.DomainSeparationTag_InteractiveSealChallengeSeed, seedEpoch, entropy.Bytes())) {
+		t.Errorf("seed = %+v", ri.Seed)
+	}
+	if len(ri.Pieces) != 1 || ri.Pieces[0].Piece.PieceCID != piece || ri.Pieces[0].DealInfo.DealID != 42 || ri.Pieces[0].DealInfo.Offset != 0 {
+		t.Errorf("pieces = %+v", ri.Pieces)
+	}
+	if chain.precommitAt != chain.head {
+		t.Errorf("precommit read at %d, want head %d", chain.precommitAt, chain.head)
+	}
+}
+
+func TestRebuildInfoAtHeight(t *testing.T) {
+	chain, _, _ := testChain(t)
+	runInfo(t, serve(t, chain), "--height", strconv.Itoa(3500000), "1234", "7")
+	if chain.precommitAt != 3500000 {
+		t.Errorf("precommit read at %d, want 3500000", chain.precommitAt)
+	}
+}
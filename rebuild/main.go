@@ -1,6 +1,7 @@
 package main
 
 import (
+	"check-sector-info/config"
 	"log"
 	"os"
 	"rebuild/internal"
@@ -17,10 +18,15 @@ func main() {
 		Version: strings.TrimPrefix(version.GetVersion(), "v"),
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "chain",
-				Value:    "http://127.0.0.1:3453/",
-				EnvVars:  []string{"CHAIN"},
-				Required: true,
+				Name:    "config",
+				Usage:   "config file, defaults to the first of " + strings.Join(config.SearchPaths(), ", ") + " that exists",
+				EnvVars: []string{"CSI_CONFIG"},
+			},
+			&cli.StringFlag{
+				Name:    "chain",
+				Value:   "http://127.0.0.1:3453/",
+				Usage:   "chain api, example:http://127.0.0.1:3453/, lotus.url of the config file is used when not set",
+				EnvVars: []string{"CHAIN"},
 			},
 			&cli.StringFlag{
 				Name:    "token",
@@ -28,6 +34,7 @@ func main() {
 				EnvVars: []string{"TOKEN"},
 			},
 		},
+		Before: internal.ApplyConfig,
 		Commands: []*cli.Command{
 			internal.RebuildInfoCmd,
 		},
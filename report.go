@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/extension"
+	"check-sector-info/output"
+	"check-sector-info/sectorreport"
+	timeToHeight "check-sector-info/time-height"
+)
+
+type SectorDetail struct {
+	Type           sectorreport.Class  `json:"type"`
+	Status         sectorreport.Status `json:"status"`
+	Sector         abi.SectorNumber    `json:"sector"`
+	Activation     abi.ChainEpoch      `json:"activation"`
+	ActivationTime time.Time           `json:"activation_time"`
+	extension.Eligibility
+	Expiration         abi.ChainEpoch  `json:"expiration"`
+	ExpirationTime     time.Time       `json:"expiration_time"`
+	DealWeight         abi.DealWeight  `json:"deal_weight"`
+	VerifiedDealWeight abi.DealWeight  `json:"verified_deal_weight"`
+	InitialPledge      decimal.Decimal `json:"initial_pledge"`
+	TerminationFee     decimal.Decimal `json:"termination_fee"`
+	DealIDs            []abi.DealID    `json:"deal_ids"`
+	DealStartEpochs    []int           `json:"deal_start_epochs"`
+}
+
+type Report struct {
+	Cluster string                          `json:"cluster,omitempty"`
+	Miner   string                          `json:"miner"`
+	At      *timeToHeight.Resolution        `json:"at,omitempty"`
+	GroupBy []string                        `json:"group_by"`
+	Days    []sectorreport.SectorInfoByDate `json:"days"`
+	Total   sectorreport.Total              `json:"total"`
+	Sectors []SectorDetail                  `json:"sectors,omitempty"`
+
+	// WithStatus is set when faulty and recovering sectors were loaded.
+	WithStatus bool `json:"-"`
+	// Terminated counts the terminated sectors still listed in partitions.
+	Terminated int `json:"terminated,omitempty"`
+}
+
+func (r Report) Write(w io.Writer, f output.Format) error {
+	switch f {
+	case output.JSON:
+		return output.WriteJSON(w, r)
+	case output.NDJSON:
+		return r.writeNDJSON(w)
+	case output.CSV:
+		return r.writeCSV(w)
+	default:
+		r.writeText(w)
+		return nil
+	}
+}
+
+func (r Report) writeText(w io.Writer) {
+	for _, d := range r.Sectors {
+		fmt.Fprintf(w, "type:%s,status:%s,sector:%d,Activation:%s,date:%s,expandable:%v,maxExpiration:%d,reason:%s,Expiration:%d,date:%s,DealWeight:%s,VerifiedDealWeight:%s,InitialPledge:%s,TerminationFee:%s,dealid:%v,DealStartEpoch:%d\n",
+			d.Type,
+			d.Status,
+			d.Sector,
+			d.Activation,
+			d.ActivationTime,
+			d.Extendable,
+			d.MaxExpiration,
+			d.Reason,
+			d.Expiration,
+			d.ExpirationTime,
+			d.DealWeight,
+			d.VerifiedDealWeight,
+			d.InitialPledge,
+			d.TerminationFee,
+			d.DealIDs,
+			d.DealStartEpochs)
+	}
+
+	for _, s := range r.Days {
+		fmt.Fprintf(w, "%s: ", s.Date)
+		for i, c := range sectorreport.Classes {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			count, pledge := s.ByClass(c)
+			fmt.Fprintf(w, "%s sector %d个，质押：%s Fil", c, count, pledge.StringFixed(4))
+		}
+		if r.WithStatus {
+			for _, st := range sectorreport.Statuses {
+				count, pledge := s.ByStatus(st)
+				fmt.Fprintf(w, ",%s sector %d个，质押：%s Fil", st, count, pledge.StringFixed(4))
+			}
+		}
+		fmt.Fprintf(w, "\t 共计sector %d个，质押：%s Fil，提前终止罚金约：%s Fil\n", s.Count(), s.Pledge().StringFixed(4), s.TerminationFee().StringFixed(4))
+	}
+
+	t := r.Total
+	fmt.Fprintln(w, "==============集群总览===============")
+	for _, c := range []sectorreport.Class{sectorreport.CC, sectorreport.OD, sectorreport.DC, sectorreport.Mixed, sectorreport.DDO, sectorreport.Unclassified} {
+		count, pledge := t.ByClass(c)
+		fmt.Fprintf(w, "%s sector \t%d个，质押：%s Fil，提前终止罚金约：%s Fil\n", c, count, pledge.StringFixed(4), t.TerminationFees[c].StringFixed(4))
+	}
+	if r.WithStatus {
+		for _, st := range sectorreport.Statuses {
+			count, pledge := t.ByStatus(st)
+			fmt.Fprintf(w, "%s sector \t%d个，质押：%s Fil\n", st, count, pledge.StringFixed(4))
+		}
+		fmt.Fprintf(w, "%s sector \t%d个，未压缩，不计入质押\n", sectorreport.Terminated, r.Terminated)
+	}
+	fmt.Fprintf(w, "共计sector \t%d个，质押：%s Fil，提前终止罚金约：%s Fil\n", t.Count(), t.Pledge().StringFixed(4), t.TerminationFee().StringFixed(4))
+}
+
+func (r Report) writeNDJSON(w io.Writer) error {
+	return r.writeNDJSONTagged(w, nil)
+}
+
+func (r Report) writeNDJSONTagged(w io.Writer, tags map[string]string) error {
+	if r.At != nil {
+		if err := output.WriteNDJSONTagged(w, "at", tags, r.At); err != nil {
+			return err
+		}
+	}
+	for _, d := range r.Sectors {
+		if err := output.WriteNDJSONTagged(w, "sector", tags, d); err != nil {
+			return err
+		}
+	}
+	for _, s := range r.Days {
+		if err := output.WriteNDJSONTagged(w, "day", tags, s); err != nil {
+			return err
+		}
+	}
+	return output.WriteNDJSONTagged(w, "total", tags, r.Total)
+}
+
+func (r Report) writeCSV(w io.Writer) error {
+	var tables []output.Table
+	if len(r.Sectors) != 0 {
+		tables = append(tables, r.sectorsTable())
+	}
+	tables = append(tables, r.daysTable())
+	return output.WriteCSV(w, tables...)
+}
+
+func (r Report) sectorsTable() output.Table {
+	t := output.Table{
+		Header: []string{"type", "status", "sector", "activation", "activation_time", "extendable", "max_expiration", "reason", "deal_end", "expiration", "expiration_time",
+			"deal_weight", "verified_deal_weight", "initial_pledge", "termination_fee", "deal_ids", "deal_start_epochs"},
+	}
+	for _, d := range r.Sectors {
+		t.Rows = append(t.Rows, []string{
+			string(d.Type),
+			string(d.Status),
+			d.Sector.String(),
+			d.Activation.String(),
+			d.ActivationTime.Format(time.RFC3339),
+			strconv.FormatBool(d.Extendable),
+			d.MaxExpiration.String(),
+			d.Reason,
+			d.DealEnd.String(),
+			d.Expiration.String(),
+			d.ExpirationTime.Format(time.RFC3339),
+			d.DealWeight.String(),
+			d.VerifiedDealWeight.String(),
+			d.InitialPledge.String(),
+			d.TerminationFee.String(),
+			joinList(d.DealIDs),
+			joinList(d.DealStartEpochs),
+		})
+	}
+	return t
+}
+
+func (r Report) daysTable() output.Table {
+	days := output.Table{Header: append([]string{}, r.GroupBy...)}
+	for _, c := range sectorreport.Classes {
+		days.Header = append(days.Header, string(c)+"_count", string(c)+"_pledge", string(c)+"_termination_fee")
+	}
+	for _, st := range sectorreport.Statuses {
+		days.Header = append(days.Header, string(st)+"_count", string(st)+"_pledge")
+	}
+	days.Header = append(days.Header, "total_count", "total_pledge", "total_termination_fee")
+
+	for _, s := range r.Days {
+		days.Rows = append(days.Rows, classRow(s.Keys, s))
+	}
+	total := make([]string, len(r.GroupBy))
+	if len(total) > 0 {
+		total[0] = "total"
+	}
+	days.Rows = append(days.Rows, classRow(total, r.Total.SectorInfoByDate))
+	return days
+}
+
+func classRow(keys []string, s sectorreport.SectorInfoByDate) []string {
+	row := append([]string{}, keys...)
+	for _, c := range sectorreport.Classes {
+		count, pledge := s.ByClass(c)
+		row = append(row, strconv.Itoa(count), pledge.String(), s.TerminationFees[c].String())
+	}
+	for _, st := range sectorreport.Statuses {
+		count, pledge := s.ByStatus(st)
+		row = append(row, strconv.Itoa(count), pledge.String())
+	}
+	return append(row, strconv.Itoa(s.Count()), s.Pledge().String(), s.TerminationFee().String())
+}
+
+func joinList[T any](list []T) string {
+	s := ""
+	for i, v := range list {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprint(v)
+	}
+	return s
+}
@@ -0,0 +1,175 @@
+package sectordiff
+
+import (
+	"sort"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/sectorreport"
+)
+
+type Category string
+
+const (
+	New        Category = "new"
+	Expired    Category = "expired"
+	Terminated Category = "terminated"
+	Extended   Category = "extended"
+	Snapped    Category = "snapped"
+	Faulty     Category = "faulty"
+	Recovered  Category = "recovered"
+)
+
+var Categories = []Category{New, Expired, Terminated, Extended, Snapped, Faulty, Recovered}
+
+// Snapshot is the live sector set of a miner at one tipset. A nil Status
+// means every sector is active.
+type Snapshot struct {
+	Height  abi.ChainEpoch
+	Sectors []*miner.SectorOnChainInfo
+	Status  func(abi.SectorNumber) sectorreport.Status
+}
+
+func (s Snapshot) status(n abi.SectorNumber) sectorreport.Status {
+	if s.Status == nil {
+		return sectorreport.Active
+	}
+	return s.Status(n)
+}
+
+func faulty(st sectorreport.Status) bool {
+	return st == sectorreport.Faulty || st == sectorreport.Recovering
+}
+
+// Change is one sector in one category, a sector can be both extended and
+// snapped. Pledge is how much pledge the change moved: added for new
+// sectors, negative for released ones and the difference for extended and
+// snapped ones. Faulty and recovered sectors keep their pledge, Pledge is
+// zero for them and StatusPledge holds the pledge at stake.
+type Change struct {
+	Category       Category         `json:"category"`
+	Sector         abi.SectorNumber `json:"sector"`
+	FromExpiration abi.ChainEpoch   `json:"from_expiration,omitempty"`
+	ToExpiration   abi.ChainEpoch   `json:"to_expiration,omitempty"`
+	FromPledge     decimal.Decimal  `json:"from_pledge"`
+	ToPledge       decimal.Decimal  `json:"to_pledge"`
+	Pledge         decimal.Decimal  `json:"pledge"`
+	StatusPledge   decimal.Decimal  `json:"status_pledge"`
+}
+
+// Summary adds up the changes of one category, Pledge and StatusPledge
+// like in Change.
+type Summary struct {
+	Category     Category        `json:"category"`
+	Count        int             `json:"count"`
+	Pledge       decimal.Decimal `json:"pledge"`
+	StatusPledge decimal.Decimal `json:"status_pledge"`
+}
+
+type Diff struct {
+	Summary []Summary `json:"summary"`
+	Changes []Change  `json:"changes"`
+}
+
+// Compare categorizes what happened to the sectors between from and to.
+// Sectors that left the live set are expired when their expiration was
+// reached by to.Height and terminated otherwise.
+func Compare(from, to Snapshot) Diff {
+	before := make(map[abi.SectorNumber]*miner.SectorOnChainInfo, len(from.Sectors))
+	for _, s := range from.Sectors {
+		before[s.SectorNumber] = s
+	}
+	after := make(map[abi.SectorNumber]*miner.SectorOnChainInfo, len(to.Sectors))
+	for _, s := range to.Sectors {
+		after[s.SectorNumber] = s
+	}
+
+	var changes []Change
+	add := func(c Category, old, cur *miner.SectorOnChainInfo) {
+		ch := Change{Category: c, FromPledge: decimal.Zero, ToPledge: decimal.Zero, Pledge: decimal.Zero, StatusPledge: decimal.Zero}
+		if old != nil {
+			ch.Sector = old.SectorNumber
+			ch.FromExpiration = old.Expiration
+			ch.FromPledge = sectorreport.AttoFilToFil(old.InitialPledge)
+		}
+		if cur != nil {
+			ch.Sector = cur.SectorNumber
+			ch.ToExpiration = cur.Expiration
+			ch.ToPledge = sectorreport.AttoFilToFil(cur.InitialPledge)
+		}
+		switch c {
+		case New:
+			ch.Pledge = ch.ToPledge
+		case Expired, Terminated:
+			ch.Pledge = ch.FromPledge.Neg()
+		case Extended, Snapped:
+			ch.Pledge = ch.ToPledge.Sub(ch.FromPledge)
+		case Faulty, Recovered:
+			ch.StatusPledge = ch.ToPledge
+		}
+		changes = append(changes, ch)
+	}
+
+	for n, old := range before {
+		if _, ok := after[n]; ok {
+			continue
+		}
+		if old.Expiration <= to.Height {
+			add(Expired, old, nil)
+		} else {
+			add(Terminated, old, nil)
+		}
+	}
+
+	for n, cur := range after {
+		old, ok := before[n]
+		if !ok {
+			add(New, nil, cur)
+			if faulty(to.status(n)) {
+				add(Faulty, nil, cur)
+			}
+			continue
+		}
+
+		if cur.Expiration > old.Expiration {
+			add(Extended, old, cur)
+		}
+		if (old.SectorKeyCID == nil && cur.SectorKeyCID != nil) || !old.SealedCID.Equals(cur.SealedCID) {
+			add(Snapped, old, cur)
+		}
+		wasFaulty, isFaulty := faulty(from.status(n)), faulty(to.status(n))
+		if !wasFaulty && isFaulty {
+			add(Faulty, old, cur)
+		}
+		if wasFaulty && !isFaulty {
+			add(Recovered, old, cur)
+		}
+	}
+
+	order := make(map[Category]int, len(Categories))
+	for i, c := range Categories {
+		order[c] = i
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Category != changes[j].Category {
+			return order[changes[i].Category] < order[changes[j].Category]
+		}
+		return changes[i].Sector < changes[j].Sector
+	})
+
+	d := Diff{Changes: changes}
+	for _, c := range Categories {
+		sum := Summary{Category: c, Pledge: decimal.Zero, StatusPledge: decimal.Zero}
+		for _, ch := range changes {
+			if ch.Category == c {
+				sum.Count++
+				sum.Pledge = sum.Pledge.Add(ch.Pledge)
+				sum.StatusPledge = sum.StatusPledge.Add(ch.StatusPledge)
+			}
+		}
+		d.Summary = append(d.Summary, sum)
+	}
+	return d
+}
@@ -0,0 +1,112 @@
+package sectordiff
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/ipfs/go-cid"
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/sectorreport"
+)
+
+var (
+	commR, _    = cid.Parse("bagboea4b5abcatlxechwbp7kjpjguna6r6q7ejrhe6mdp3lf34pmswn27pkkiekz")
+	newCommR, _ = cid.Parse("bagboea4b5abcamxkzmzcciuvc2lwfiz6gnlbdlgv7jmwpsulcqccmlrbrp5wiwdq")
+)
+
+func sector(n abi.SectorNumber, exp abi.ChainEpoch, fil int64) *miner.SectorOnChainInfo {
+	return &miner.SectorOnChainInfo{
+		SectorNumber:  n,
+		SealedCID:     commR,
+		Expiration:    exp,
+		InitialPledge: big.Mul(big.NewInt(fil), big.NewInt(1e18)),
+	}
+}
+
+func TestCompare(t *testing.T) {
+	from := Snapshot{
+		Height: 1000,
+		Sectors: []*miner.SectorOnChainInfo{
+			sector(1, 1500, 1), // expires
+			sector(2, 9000, 2), // terminated early
+			sector(3, 5000, 3), // extended and snapped
+			sector(4, 5000, 4), // turns faulty
+			sector(5, 5000, 5), // recovers
+			sector(6, 5000, 6), // unchanged
+		},
+		Status: func(n abi.SectorNumber) sectorreport.Status {
+			if n == 5 {
+				return sectorreport.Faulty
+			}
+			return sectorreport.Active
+		},
+	}
+
+	extended := sector(3, 8000, 4)
+	extended.SealedCID = newCommR
+	extended.SectorKeyCID = &commR
+	to := Snapshot{
+		Height: 2000,
+		Sectors: []*miner.SectorOnChainInfo{
+			extended,
+			sector(4, 5000, 4),
+			sector(5, 5000, 5),
+			sector(6, 5000, 6),
+			sector(7, 9000, 7), // new
+		},
+		Status: func(n abi.SectorNumber) sectorreport.Status {
+			if n == 4 {
+				return sectorreport.Recovering
+			}
+			return sectorreport.Active
+		},
+	}
+
+	d := Compare(from, to)
+
+	// faulty and recovered sectors move no pledge
+	want := map[Category]struct {
+		count                int
+		pledge, statusPledge int64
+	}{
+		New:        {1, 7, 0},
+		Expired:    {1, -1, 0},
+		Terminated: {1, -2, 0},
+		Extended:   {1, 1, 0},
+		Snapped:    {1, 1, 0},
+		Faulty:     {1, 0, 4},
+		Recovered:  {1, 0, 5},
+	}
+	if len(d.Summary) != len(Categories) {
+		t.Fatalf("got %d summary rows", len(d.Summary))
+	}
+	for _, s := range d.Summary {
+		w := want[s.Category]
+		if s.Count != w.count || !s.Pledge.Equal(decimal.NewFromInt(w.pledge)) || !s.StatusPledge.Equal(decimal.NewFromInt(w.statusPledge)) {
+			t.Errorf("%s: count=%d pledge=%s status pledge=%s, want %d/%d/%d", s.Category, s.Count, s.Pledge, s.StatusPledge, w.count, w.pledge, w.statusPledge)
+		}
+	}
+
+	if len(d.Changes) != 7 {
+		t.Fatalf("got %d changes, want 7", len(d.Changes))
+	}
+	for i, c := range d.Changes {
+		if c.Category != Categories[i] {
+			t.Errorf("change %d is %s, want %s", i, c.Category, Categories[i])
+		}
+	}
+	if c := d.Changes[3]; c.Sector != 3 || c.FromExpiration != 5000 || c.ToExpiration != 8000 {
+		t.Errorf("extended change = %+v", c)
+	}
+}
+
+func TestCompareNilStatus(t *testing.T) {
+	s := []*miner.SectorOnChainInfo{sector(1, 5000, 1)}
+	d := Compare(Snapshot{Height: 1, Sectors: s}, Snapshot{Height: 2, Sectors: s})
+	if len(d.Changes) != 0 {
+		t.Errorf("unchanged sectors produced %+v", d.Changes)
+	}
+}
@@ -0,0 +1,61 @@
+package sectorreport
+
+import (
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+)
+
+// Bucket has the day row columns plus the expiration range of its sectors.
+type Bucket struct {
+	SectorInfoByDate
+	EarliestExpiration abi.ChainEpoch `json:"earliest_expiration"`
+	LatestExpiration   abi.ChainEpoch `json:"latest_expiration"`
+}
+
+func (b *Bucket) add(sector *miner.SectorOnChainInfo, opts Options) {
+	if b.Count() == 0 || sector.Expiration < b.EarliestExpiration {
+		b.EarliestExpiration = sector.Expiration
+	}
+	if sector.Expiration > b.LatestExpiration {
+		b.LatestExpiration = sector.Expiration
+	}
+	b.SectorInfoByDate.add(sector, opts)
+}
+
+type PartitionRow struct {
+	Partition uint64 `json:"partition"`
+	Bucket
+}
+
+type DeadlineRow struct {
+	Deadline uint64 `json:"deadline"`
+	Bucket
+	Partitions []PartitionRow `json:"partitions"`
+}
+
+// LocateFunc returns the deadline and partition a sector is assigned to.
+type LocateFunc func(abi.SectorNumber) (deadline, partition uint64, ok bool)
+
+// GroupByDeadline buckets sectors by deadline and partition. Every deadline
+// and partition of partitionCounts gets a row, even when empty. Sectors that
+// cannot be located are skipped.
+func GroupByDeadline(sectors []*miner.SectorOnChainInfo, partitionCounts []int, locate LocateFunc, opts Options) []DeadlineRow {
+	rows := make([]DeadlineRow, len(partitionCounts))
+	for dl, n := range partitionCounts {
+		rows[dl].Deadline = uint64(dl)
+		rows[dl].Partitions = make([]PartitionRow, n)
+		for p := range rows[dl].Partitions {
+			rows[dl].Partitions[p].Partition = uint64(p)
+		}
+	}
+
+	for _, sector := range sectors {
+		dl, part, ok := locate(sector.SectorNumber)
+		if !ok || dl >= uint64(len(rows)) || part >= uint64(len(rows[dl].Partitions)) {
+			continue
+		}
+		rows[dl].add(sector, opts)
+		rows[dl].Partitions[part].add(sector, opts)
+	}
+	return rows
+}
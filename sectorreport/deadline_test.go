@@ -0,0 +1,70 @@
+package sectorreport
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+)
+
+func TestGroupByDeadline(t *testing.T) {
+	locations := map[abi.SectorNumber][2]uint64{
+		1: {0, 0},
+		2: {0, 1},
+		3: {0, 0},
+		4: {2, 0},
+		// deadline 1 has no partition, deadline 5 does not exist
+		6: {1, 0},
+		7: {5, 0},
+	}
+	locate := func(n abi.SectorNumber) (uint64, uint64, bool) {
+		loc, ok := locations[n]
+		return loc[0], loc[1], ok
+	}
+	sectors := []*miner.SectorOnChainInfo{
+		sector(1, 100, 0, 0, "1"),
+		sector(2, 300, 10, 0, "2"),
+		sector(3, 50, 0, 0, "4"),
+		sector(4, 200, 0, 0, "8"),
+		// not in any partition
+		sector(5, 10, 0, 0, "16"),
+		sector(6, 10, 0, 0, "32"),
+		sector(7, 10, 0, 0, "64"),
+	}
+	rows := GroupByDeadline(sectors, []int{2, 0, 1}, locate, Options{
+		Status: func(n abi.SectorNumber) Status {
+			if n == 4 {
+				return Faulty
+			}
+			return Active
+		},
+	})
+
+	// pledges are in attoFIL
+	describe := func(b Bucket) string {
+		return fmt.Sprintf("%d sectors cc %d od %d faulty %d pledge %s expiring %d-%d", b.Count(), b.CcCount, b.OdCount, b.FaultyCount,
+			b.Pledge().Shift(18), b.EarliestExpiration, b.LatestExpiration)
+	}
+	var got []string
+	for i, dl := range rows {
+		if dl.Deadline != uint64(i) {
+			t.Errorf("row %d is deadline %d", i, dl.Deadline)
+		}
+		got = append(got, fmt.Sprintf("dl %d: %s", dl.Deadline, describe(dl.Bucket)))
+		for _, p := range dl.Partitions {
+			got = append(got, fmt.Sprintf("  part %d: %s", p.Partition, describe(p.Bucket)))
+		}
+	}
+	want := []string{
+		"dl 0: 3 sectors cc 2 od 1 faulty 0 pledge 7 expiring 50-300",
+		"  part 0: 2 sectors cc 2 od 0 faulty 0 pledge 5 expiring 50-100",
+		"  part 1: 1 sectors cc 0 od 1 faulty 0 pledge 2 expiring 300-300",
+		"dl 1: 0 sectors cc 0 od 0 faulty 0 pledge 0 expiring 0-0",
+		"dl 2: 1 sectors cc 1 od 0 faulty 1 pledge 8 expiring 200-200",
+		"  part 0: 1 sectors cc 1 od 0 faulty 1 pledge 8 expiring 200-200",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("rows\n%q\nwant\n%q", got, want)
+	}
+}
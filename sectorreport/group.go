@@ -0,0 +1,213 @@
+package sectorreport
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+
+	timeToHeight "check-sector-info/time-height"
+)
+
+// Dimension is one column a report can be grouped by. Key gets the Options
+// the report is grouped with.
+type Dimension interface {
+	Name() string
+	Key(*miner.SectorOnChainInfo, Options) string
+}
+
+type Granularity string
+
+const (
+	Day     Granularity = "day"
+	Week    Granularity = "week"
+	Month   Granularity = "month"
+	Quarter Granularity = "quarter"
+)
+
+// Format renders t as a bucket label that sorts chronologically.
+func (g Granularity) Format(t time.Time) string {
+	switch g {
+	case Week:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case Month:
+		return t.Format("2006-01")
+	case Quarter:
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+func parseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case Day, Week, Month, Quarter:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unknown granularity %q, must be one of day, week, month, quarter", s)
+	}
+}
+
+type epochDimension struct {
+	name  string
+	epoch func(*miner.SectorOnChainInfo) abi.ChainEpoch
+	g     Granularity
+}
+
+func (d epochDimension) Name() string {
+	return d.name + "_" + string(d.g)
+}
+
+func (d epochDimension) Key(s *miner.SectorOnChainInfo, _ Options) string {
+	return d.g.Format(timeToHeight.HeightToTime(d.epoch(s)))
+}
+
+func Expiration(g Granularity) Dimension {
+	return epochDimension{name: "expiration", g: g, epoch: func(s *miner.SectorOnChainInfo) abi.ChainEpoch { return s.Expiration }}
+}
+
+func Activation(g Granularity) Dimension {
+	return epochDimension{name: "activation", g: g, epoch: func(s *miner.SectorOnChainInfo) abi.ChainEpoch { return s.Activation }}
+}
+
+type proofDimension struct{}
+
+func (proofDimension) Name() string { return "proof" }
+
+func (proofDimension) Key(s *miner.SectorOnChainInfo, _ Options) string {
+	size, err := s.SealProof.SectorSize()
+	if err != nil {
+		return strconv.FormatInt(int64(s.SealProof), 10)
+	}
+	return fmt.Sprintf("%s(%d)", size.ShortString(), s.SealProof)
+}
+
+type classDimension struct{}
+
+func (classDimension) Name() string { return "class" }
+
+func (classDimension) Key(s *miner.SectorOnChainInfo, opts Options) string {
+	return string(Classify(s, opts.Thresholds))
+}
+
+var (
+	Proof   Dimension = proofDimension{}
+	ByClass Dimension = classDimension{}
+)
+
+// ParseDimensions parses a comma separated list like "expiration:month,class".
+// expiration and activation take an optional granularity, which defaults to
+// day and month.
+func ParseDimensions(spec string) ([]Dimension, error) {
+	var dims []Dimension
+	for _, part := range strings.Split(spec, ",") {
+		name, gran, _ := strings.Cut(strings.TrimSpace(part), ":")
+
+		var d Dimension
+		switch name {
+		case "expiration", "activation":
+			g := Day
+			if name == "activation" {
+				g = Month
+			}
+			if gran != "" {
+				var err error
+				if g, err = parseGranularity(gran); err != nil {
+					return nil, err
+				}
+			}
+			if name == "expiration" {
+				d = Expiration(g)
+			} else {
+				d = Activation(g)
+			}
+		case "proof":
+			d = Proof
+		case "class":
+			d = ByClass
+		default:
+			return nil, fmt.Errorf("unknown group dimension %q, must be one of expiration, activation, proof, class", name)
+		}
+
+		if gran != "" && name != "expiration" && name != "activation" {
+			return nil, fmt.Errorf("group dimension %q takes no granularity", name)
+		}
+		dims = append(dims, d)
+	}
+	if len(dims) == 0 {
+		return nil, fmt.Errorf("no group dimension given")
+	}
+	return dims, nil
+}
+
+// Group buckets sectors by the combination of dims. Keys holds one value per
+// dimension and Date their "/" joined label. Rows are sorted by their keys.
+func Group(sectors []*miner.SectorOnChainInfo, dims []Dimension, opts Options) []SectorInfoByDate {
+	groups := make(map[string]*SectorInfoByDate)
+	for _, sector := range sectors {
+		keys := make([]string, len(dims))
+		for i, d := range dims {
+			keys[i] = d.Key(sector, opts)
+		}
+		label := strings.Join(keys, "/")
+
+		g, ok := groups[label]
+		if !ok {
+			g = &SectorInfoByDate{Date: label, Keys: keys}
+			groups[label] = g
+		}
+		g.add(sector, opts)
+	}
+
+	return sortedRows(groups)
+}
+
+// Merge adds up the rows with the same label from several reports that were
+// grouped by the same dimensions, e.g. one per miner.
+func Merge(reports ...[]SectorInfoByDate) []SectorInfoByDate {
+	groups := make(map[string]*SectorInfoByDate)
+	for _, rows := range reports {
+		for _, row := range rows {
+			g, ok := groups[row.Date]
+			if !ok {
+				g = &SectorInfoByDate{Date: row.Date, Keys: row.Keys}
+				groups[row.Date] = g
+			}
+			g.merge(row)
+		}
+	}
+	return sortedRows(groups)
+}
+
+func sortedRows(groups map[string]*SectorInfoByDate) []SectorInfoByDate {
+	rows := make([]SectorInfoByDate, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, *g)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i].Keys, rows[j].Keys
+		for k := range a {
+			if k >= len(b) {
+				return false
+			}
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return rows
+}
+
+func DimensionNames(dims []Dimension) []string {
+	names := make([]string, len(dims))
+	for i, d := range dims {
+		names[i] = d.Name()
+	}
+	return names
+}
@@ -0,0 +1,110 @@
+package sectorreport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+)
+
+func TestGranularityFormat(t *testing.T) {
+	day := time.Date(2024, time.December, 30, 12, 0, 0, 0, time.Local)
+	for g, want := range map[Granularity]string{
+		Day:     "2024-12-30",
+		Week:    "2025-W01",
+		Month:   "2024-12",
+		Quarter: "2024-Q4",
+	} {
+		if got := g.Format(day); got != want {
+			t.Errorf("%s: got %s, want %s", g, got, want)
+		}
+	}
+}
+
+func TestParseDimensions(t *testing.T) {
+	dims, err := ParseDimensions("expiration:month, class,activation,proof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := DimensionNames(dims)
+	want := []string{"expiration_month", "class", "activation_month", "proof"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+
+	for _, spec := range []string{"", "expiration:year", "class:day", "owner"} {
+		if _, err := ParseDimensions(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestGroupByMonthAndClass(t *testing.T) {
+	exp := abi.ChainEpoch(4_000_000)
+	sectors := []*miner.SectorOnChainInfo{
+		sector(1, exp, 0, 0, "1000000000000000000"),
+		sector(2, exp, 0, 0, "1000000000000000000"),
+		sector(3, exp, 7, 0, "1000000000000000000"),
+		sector(4, exp+60*epochsPerDay, 0, 0, "1000000000000000000"),
+	}
+
+	dims, err := ParseDimensions("expiration:month,class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := Group(sectors, dims, Options{})
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if rows[0].Keys[1] != string(CC) || rows[0].CcCount != 2 {
+		t.Errorf("first row %v cc=%d, want cc/2", rows[0].Keys, rows[0].CcCount)
+	}
+	if rows[1].Keys[1] != string(OD) || rows[1].Keys[0] != rows[0].Keys[0] {
+		t.Errorf("second row %v, want same month od", rows[1].Keys)
+	}
+	if rows[2].Keys[0] <= rows[0].Keys[0] {
+		t.Errorf("rows not sorted by month: %v, %v", rows[0].Keys, rows[2].Keys)
+	}
+	if Sum(rows).Count() != len(sectors) {
+		t.Errorf("total count = %d, want %d", Sum(rows).Count(), len(sectors))
+	}
+
+	// the class key and the counts follow the thresholds of the options
+	rows = Group(sectors, dims, Options{Thresholds: Thresholds{MinDealWeight: 10}})
+	if len(rows) != 2 || rows[0].Keys[1] != string(CC) || rows[0].CcCount != 3 {
+		t.Errorf("rows with dust deal weight %+v", rows)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	exp := abi.ChainEpoch(4_000_000)
+	a := GroupByExpirationDay([]*miner.SectorOnChainInfo{
+		sector(1, exp, 0, 0, "1000000000000000000"),
+		sector(2, exp+epochsPerDay, 7, 0, "2000000000000000000"),
+	}, Options{})
+	b := GroupByExpirationDay([]*miner.SectorOnChainInfo{
+		sector(1, exp, 0, 0, "500000000000000000"),
+		sector(2, exp+2*epochsPerDay, 0, 0, "1"),
+	}, Options{})
+
+	rows := Merge(a, b)
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if rows[0].Date != a[0].Date || rows[0].CcCount != 2 || rows[0].CcPledge.String() != "1.5" {
+		t.Errorf("first row %s cc=%d pledge=%s, want 2/1.5", rows[0].Date, rows[0].CcCount, rows[0].CcPledge)
+	}
+	if rows[1].OdCount != 1 || rows[2].CcCount != 1 {
+		t.Errorf("unexpected rows %+v", rows[1:])
+	}
+	if total := Sum(rows); total.Count() != 4 || !total.Pledge().Equal(Sum(a).Pledge().Add(Sum(b).Pledge())) {
+		t.Errorf("merged total %d/%s", total.Count(), total.Pledge())
+	}
+}
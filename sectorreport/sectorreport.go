@@ -0,0 +1,319 @@
+package sectorreport
+
+import (
+	"math/big"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/shopspring/decimal"
+)
+
+type Class string
+
+const (
+	CC           Class = "cc"
+	DC           Class = "dc"
+	OD           Class = "od"
+	Mixed        Class = "mixed"
+	DDO          Class = "ddo"
+	Unclassified Class = "unclassified"
+)
+
+var Classes = []Class{CC, DC, OD, Mixed, DDO, Unclassified}
+
+// Thresholds tune Classify. Deal weight below MinDealWeight is ignored as
+// dust. A mixed sector with at least MixedDCShare of its deal weight verified
+// counts as verified only, one with at least MixedDCShare unverified as od. The zero
+// value keeps the plain rules.
+//
+// DealIDsKnown tells Classify that the deal ids of the sectors were restored,
+// the json api always drops them. Without it a sector cannot be told to hold
+// no market deals and verified sectors are dc, never ddo.
+type Thresholds struct {
+	MinDealWeight int64
+	MixedDCShare  float64
+	DealIDsKnown  bool
+}
+
+// Classify derives the sector type from its deal weights and deal ids:
+//
+//	cc:    no deal weight at all
+//	dc:    verified weight only, backed by builtin market deals
+//	ddo:   verified weight only, without builtin market deals, see
+//	       Thresholds.DealIDsKnown
+//	od:    unverified weight only
+//	mixed: both verified and unverified weight
+//
+// Anything else, e.g. deals without weight, is unclassified so that it still
+// shows up in the totals. See Thresholds for the tuning of these rules.
+func Classify(s *miner.SectorOnChainInfo, t Thresholds) Class {
+	dw, vdw := t.sign(s.DealWeight), t.sign(s.VerifiedDealWeight)
+	if dw > 0 && vdw > 0 && t.MixedDCShare > 0 {
+		total := new(big.Float).SetInt(new(big.Int).Add(s.DealWeight.Int, s.VerifiedDealWeight.Int))
+		share := func(w abi.DealWeight) float64 {
+			f, _ := new(big.Float).Quo(new(big.Float).SetInt(w.Int), total).Float64()
+			return f
+		}
+		switch {
+		case share(s.VerifiedDealWeight) >= t.MixedDCShare:
+			dw = 0
+		case share(s.DealWeight) >= t.MixedDCShare:
+			vdw = 0
+		}
+	}
+
+	switch {
+	case dw < 0 || vdw < 0:
+		return Unclassified
+	case dw == 0 && vdw == 0:
+		if len(s.DeprecatedDealIDs) != 0 {
+			return Unclassified
+		}
+		return CC
+	case dw == 0:
+		if t.DealIDsKnown && len(s.DeprecatedDealIDs) == 0 {
+			return DDO
+		}
+		return DC
+	case vdw == 0:
+		return OD
+	default:
+		return Mixed
+	}
+}
+
+type Status string
+
+const (
+	Active     Status = "active"
+	Faulty     Status = "faulty"
+	Recovering Status = "recovering"
+	// Terminated sectors are still listed in their partition but no longer
+	// hold pledge, they are not part of the expiration schedule.
+	Terminated Status = "terminated"
+)
+
+var Statuses = []Status{Active, Faulty, Recovering}
+
+func (t Thresholds) sign(w abi.DealWeight) int {
+	if w.Int == nil {
+		return 0
+	}
+	if w.Int.Sign() > 0 && w.Int.IsInt64() && w.Int.Int64() < t.MinDealWeight {
+		return 0
+	}
+	return w.Int.Sign()
+}
+
+// SectorInfoByDate is one report row. Date is the row label, the expiration
+// day unless the row comes from Group with other dimensions. Pledges are exact
+// FIL amounts, see AttoFilToFil.
+type SectorInfoByDate struct {
+	Date               string          `json:"date,omitempty"`
+	Keys               []string        `json:"keys,omitempty"`
+	DcCount            int             `json:"dc_count"`
+	CcCount            int             `json:"cc_count"`
+	OdCount            int             `json:"od_count"`
+	MixedCount         int             `json:"mixed_count"`
+	DdoCount           int             `json:"ddo_count"`
+	UnclassifiedCount  int             `json:"unclassified_count"`
+	DCPledge           decimal.Decimal `json:"dc_pledge"`
+	CcPledge           decimal.Decimal `json:"cc_pledge"`
+	OdPledge           decimal.Decimal `json:"od_pledge"`
+	MixedPledge        decimal.Decimal `json:"mixed_pledge"`
+	DdoPledge          decimal.Decimal `json:"ddo_pledge"`
+	UnclassifiedPledge decimal.Decimal `json:"unclassified_pledge"`
+	ActiveCount        int             `json:"active_count"`
+	FaultyCount        int             `json:"faulty_count"`
+	RecoveringCount    int             `json:"recovering_count"`
+	ActivePledge       decimal.Decimal `json:"active_pledge"`
+	FaultyPledge       decimal.Decimal `json:"faulty_pledge"`
+	RecoveringPledge   decimal.Decimal `json:"recovering_pledge"`
+	// TerminationFees is the estimated early termination fee per class,
+	// only set when grouping with a FeeFunc.
+	TerminationFees map[Class]decimal.Decimal `json:"termination_fees,omitempty"`
+}
+
+// FeeFunc estimates the early termination fee of a sector.
+type FeeFunc func(*miner.SectorOnChainInfo) abi.TokenAmount
+
+type Options struct {
+	// TerminationFee is optional, fees are not estimated when nil.
+	TerminationFee FeeFunc
+	// Status is optional, every sector is active when nil.
+	Status func(abi.SectorNumber) Status
+	// Thresholds are passed to Classify.
+	Thresholds Thresholds
+}
+
+func (s *SectorInfoByDate) add(sector *miner.SectorOnChainInfo, opts Options) {
+	class := Classify(sector, opts.Thresholds)
+	if opts.TerminationFee != nil {
+		s.addTerminationFee(class, AttoFilToFil(opts.TerminationFee(sector)))
+	}
+
+	f := AttoFilToFil(sector.InitialPledge)
+
+	status := Active
+	if opts.Status != nil {
+		status = opts.Status(sector.SectorNumber)
+	}
+	switch status {
+	case Faulty:
+		s.FaultyCount += 1
+		s.FaultyPledge = s.FaultyPledge.Add(f)
+	case Recovering:
+		s.RecoveringCount += 1
+		s.RecoveringPledge = s.RecoveringPledge.Add(f)
+	default:
+		s.ActiveCount += 1
+		s.ActivePledge = s.ActivePledge.Add(f)
+	}
+
+	switch class {
+	case CC:
+		s.CcCount += 1
+		s.CcPledge = s.CcPledge.Add(f)
+	case DC:
+		s.DcCount += 1
+		s.DCPledge = s.DCPledge.Add(f)
+	case OD:
+		s.OdCount += 1
+		s.OdPledge = s.OdPledge.Add(f)
+	case Mixed:
+		s.MixedCount += 1
+		s.MixedPledge = s.MixedPledge.Add(f)
+	case DDO:
+		s.DdoCount += 1
+		s.DdoPledge = s.DdoPledge.Add(f)
+	default:
+		s.UnclassifiedCount += 1
+		s.UnclassifiedPledge = s.UnclassifiedPledge.Add(f)
+	}
+}
+
+// ByClass returns the count and pledge of one sector class.
+func (s SectorInfoByDate) ByClass(c Class) (int, decimal.Decimal) {
+	switch c {
+	case CC:
+		return s.CcCount, s.CcPledge
+	case DC:
+		return s.DcCount, s.DCPledge
+	case OD:
+		return s.OdCount, s.OdPledge
+	case Mixed:
+		return s.MixedCount, s.MixedPledge
+	case DDO:
+		return s.DdoCount, s.DdoPledge
+	default:
+		return s.UnclassifiedCount, s.UnclassifiedPledge
+	}
+}
+
+// ByStatus returns the count and pledge of one sector status.
+func (s SectorInfoByDate) ByStatus(st Status) (int, decimal.Decimal) {
+	switch st {
+	case Faulty:
+		return s.FaultyCount, s.FaultyPledge
+	case Recovering:
+		return s.RecoveringCount, s.RecoveringPledge
+	case Active:
+		return s.ActiveCount, s.ActivePledge
+	default:
+		return 0, decimal.Zero
+	}
+}
+
+func (s *SectorInfoByDate) addTerminationFee(c Class, fee decimal.Decimal) {
+	if s.TerminationFees == nil {
+		s.TerminationFees = make(map[Class]decimal.Decimal)
+	}
+	s.TerminationFees[c] = s.TerminationFees[c].Add(fee)
+}
+
+// TerminationFee is the estimated termination fee of all classes.
+func (s SectorInfoByDate) TerminationFee() decimal.Decimal {
+	f := decimal.Zero
+	for _, fee := range s.TerminationFees {
+		f = f.Add(fee)
+	}
+	return f
+}
+
+func (s SectorInfoByDate) Count() int {
+	var n int
+	for _, c := range Classes {
+		count, _ := s.ByClass(c)
+		n += count
+	}
+	return n
+}
+
+func (s SectorInfoByDate) Pledge() decimal.Decimal {
+	p := decimal.Zero
+	for _, c := range Classes {
+		_, pledge := s.ByClass(c)
+		p = p.Add(pledge)
+	}
+	return p
+}
+
+type SortByDate []SectorInfoByDate
+
+func (s SortByDate) Len() int      { return len(s) }
+func (s SortByDate) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s SortByDate) Less(i, j int) bool {
+	return s[i].Date < s[j].Date
+}
+
+// Total has the same columns as a day row, with an empty date.
+type Total struct {
+	SectorInfoByDate
+}
+
+// GroupByExpirationDay buckets sectors by the local day of their expiration
+// epoch, sorted by date.
+func GroupByExpirationDay(sectors []*miner.SectorOnChainInfo, opts Options) []SectorInfoByDate {
+	return Group(sectors, []Dimension{Expiration(Day)}, opts)
+}
+
+func Sum(days []SectorInfoByDate) Total {
+	var t Total
+	for _, s := range days {
+		t.merge(s)
+	}
+	return t
+}
+
+// merge adds the counts, pledges and fees of o to s.
+func (s *SectorInfoByDate) merge(o SectorInfoByDate) {
+	s.CcCount += o.CcCount
+	s.DcCount += o.DcCount
+	s.OdCount += o.OdCount
+	s.MixedCount += o.MixedCount
+	s.DdoCount += o.DdoCount
+	s.UnclassifiedCount += o.UnclassifiedCount
+	s.CcPledge = s.CcPledge.Add(o.CcPledge)
+	s.DCPledge = s.DCPledge.Add(o.DCPledge)
+	s.OdPledge = s.OdPledge.Add(o.OdPledge)
+	s.MixedPledge = s.MixedPledge.Add(o.MixedPledge)
+	s.DdoPledge = s.DdoPledge.Add(o.DdoPledge)
+	s.UnclassifiedPledge = s.UnclassifiedPledge.Add(o.UnclassifiedPledge)
+	s.ActiveCount += o.ActiveCount
+	s.FaultyCount += o.FaultyCount
+	s.RecoveringCount += o.RecoveringCount
+	s.ActivePledge = s.ActivePledge.Add(o.ActivePledge)
+	s.FaultyPledge = s.FaultyPledge.Add(o.FaultyPledge)
+	s.RecoveringPledge = s.RecoveringPledge.Add(o.RecoveringPledge)
+	for c, fee := range o.TerminationFees {
+		s.addTerminationFee(c, fee)
+	}
+}
+
+// AttoFilToFil converts an attoFIL amount to FIL without rounding.
+func AttoFilToFil(ta abi.TokenAmount) decimal.Decimal {
+	if ta.Int == nil {
+		return decimal.Zero
+	}
+	return decimal.NewFromBigInt(ta.Int, -18)
+}
@@ -0,0 +1,187 @@
+package sectorreport
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/shopspring/decimal"
+
+	timeToHeight "check-sector-info/time-height"
+)
+
+const epochsPerDay = 2880
+
+func sector(num abi.SectorNumber, exp abi.ChainEpoch, dw, vdw int64, pledge string) *miner.SectorOnChainInfo {
+	p, err := big.FromString(pledge)
+	if err != nil {
+		panic(err)
+	}
+	return &miner.SectorOnChainInfo{
+		SectorNumber:       num,
+		Expiration:         exp,
+		DealWeight:         big.NewInt(dw),
+		VerifiedDealWeight: big.NewInt(vdw),
+		InitialPledge:      p,
+	}
+}
+
+func TestClassify(t *testing.T) {
+	known := Thresholds{DealIDsKnown: true}
+	cases := []struct {
+		dw, vdw int64
+		deals   []abi.DealID
+		want    Class
+	}{
+		{0, 0, nil, CC},
+		{0, 10, []abi.DealID{1}, DC},
+		{0, 10, nil, DDO},
+		{10, 0, []abi.DealID{1}, OD},
+		{10, 0, nil, OD},
+		{10, 10, []abi.DealID{1, 2}, Mixed},
+		{10, 10, nil, Mixed},
+		{0, 0, []abi.DealID{1}, Unclassified},
+		{-1, 0, nil, Unclassified},
+	}
+	for _, c := range cases {
+		s := sector(1, 0, c.dw, c.vdw, "0")
+		s.DeprecatedDealIDs = c.deals
+		if got := Classify(s, known); got != c.want {
+			t.Errorf("Classify(dw=%d, vdw=%d, deals=%v) = %q, want %q", c.dw, c.vdw, c.deals, got, c.want)
+		}
+	}
+
+	nilWeights := &miner.SectorOnChainInfo{}
+	if got := Classify(nilWeights, known); got != CC {
+		t.Errorf("Classify(nil weights) = %q, want %q", got, CC)
+	}
+
+	// without the deal ids a verified sector is dc, not ddo
+	if got := Classify(sector(1, 0, 0, 10, "0"), Thresholds{}); got != DC {
+		t.Errorf("Classify(unknown deal ids) = %q, want %q", got, DC)
+	}
+}
+
+func TestClassifyThresholds(t *testing.T) {
+	tuned := Thresholds{MinDealWeight: 5, MixedDCShare: 0.9, DealIDsKnown: true}
+	cases := []struct {
+		dw, vdw int64
+		deals   []abi.DealID
+		want    Class
+	}{
+		{4, 0, nil, CC},
+		{4, 10, []abi.DealID{1}, DC},
+		{5, 0, nil, OD},
+		{10, 90, []abi.DealID{1, 2}, DC},
+		{10, 90, nil, DDO},
+		{90, 10, nil, OD},
+		{50, 50, nil, Mixed},
+	}
+	for _, c := range cases {
+		s := sector(1, 0, c.dw, c.vdw, "0")
+		s.DeprecatedDealIDs = c.deals
+		if got := Classify(s, tuned); got != c.want {
+			t.Errorf("Classify(dw=%d, vdw=%d, deals=%v) = %q, want %q", c.dw, c.vdw, c.deals, got, c.want)
+		}
+	}
+}
+
+func TestGroupByExpirationDay(t *testing.T) {
+	day1 := abi.ChainEpoch(4_000_000)
+	day2 := day1 + 3*epochsPerDay
+
+	sectors := []*miner.SectorOnChainInfo{
+		sector(1, day2, 0, 0, "1000000000000000000"),
+		sector(2, day1, 0, 5, "2000000000000000000"),
+		sector(3, day1, 0, 0, "500000000000000000"),
+		sector(4, day1, 7, 0, "250000000000000000"),
+		sector(5, day2, 7, 5, "125000000000000000"),
+		sector(6, day2, -1, 0, "1"),
+	}
+	sectors[1].DeprecatedDealIDs = []abi.DealID{42}
+
+	days := GroupByExpirationDay(sectors, Options{})
+	if len(days) != 2 {
+		t.Fatalf("got %d days, want 2", len(days))
+	}
+
+	first, second := days[0], days[1]
+	if first.Date != timeToHeight.HeightToDay(day1) || second.Date != timeToHeight.HeightToDay(day2) {
+		t.Fatalf("unexpected day order: %s, %s", first.Date, second.Date)
+	}
+	if first.CcCount != 1 || first.DcCount != 1 || first.OdCount != 1 {
+		t.Errorf("day1 counts cc=%d dc=%d od=%d, want 1/1/1", first.CcCount, first.DcCount, first.OdCount)
+	}
+	if !first.CcPledge.Equal(decimal.RequireFromString("0.5")) ||
+		!first.DCPledge.Equal(decimal.NewFromInt(2)) ||
+		!first.OdPledge.Equal(decimal.RequireFromString("0.25")) {
+		t.Errorf("day1 pledge cc=%v dc=%v od=%v", first.CcPledge, first.DCPledge, first.OdPledge)
+	}
+	if second.CcCount != 1 || !second.CcPledge.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("day2 cc=%d pledge=%v, want 1/1", second.CcCount, second.CcPledge)
+	}
+	if second.MixedCount != 1 || second.UnclassifiedCount != 1 || second.Count() != 3 {
+		t.Errorf("day2 mixed=%d unclassified=%d total=%d, want 1/1/3", second.MixedCount, second.UnclassifiedCount, second.Count())
+	}
+
+	total := Sum(days)
+	if total.CcCount != 2 || total.DcCount != 1 || total.OdCount != 1 {
+		t.Errorf("total counts cc=%d dc=%d od=%d", total.CcCount, total.DcCount, total.OdCount)
+	}
+	if total.Count() != len(sectors) {
+		t.Errorf("total count = %d, want %d", total.Count(), len(sectors))
+	}
+	if !total.CcPledge.Equal(decimal.RequireFromString("1.5")) {
+		t.Errorf("total cc pledge = %v, want 1.5", total.CcPledge)
+	}
+}
+
+func TestTotalsMatchAttoFilSum(t *testing.T) {
+	var sectors []*miner.SectorOnChainInfo
+	chainSum := big.Zero()
+	exp := abi.ChainEpoch(4_000_000)
+
+	// pledges with all 18 fractional digits set, float64 sums of these drift
+	for i := 0; i < 10000; i++ {
+		pledge := big.Add(big.NewInt(int64(123456789012345678)), big.NewInt(int64(i)*1_000_000_007))
+		chainSum = big.Add(chainSum, pledge)
+
+		var dw, vdw int64
+		switch i % 4 {
+		case 1:
+			vdw = 1
+		case 2:
+			dw = 1
+		case 3:
+			dw, vdw = 1, 1
+		}
+		sectors = append(sectors, sector(abi.SectorNumber(i), exp+abi.ChainEpoch(i%50)*epochsPerDay, dw, vdw, pledge.String()))
+	}
+
+	total := Sum(GroupByExpirationDay(sectors, Options{}))
+	if total.Count() != len(sectors) {
+		t.Fatalf("total count = %d, want %d", total.Count(), len(sectors))
+	}
+
+	want := AttoFilToFil(chainSum)
+	if !total.Pledge().Equal(want) {
+		t.Fatalf("total pledge = %s, want %s", total.Pledge(), want)
+	}
+
+	atto := total.Pledge().Shift(18)
+	if !atto.IsInteger() || atto.BigInt().Cmp(chainSum.Int) != 0 {
+		t.Fatalf("total pledge %s attoFIL, chain sum %s attoFIL", atto, chainSum)
+	}
+}
+
+func TestAttoFilToFil(t *testing.T) {
+	if got := AttoFilToFil(abi.TokenAmount{}); !got.IsZero() {
+		t.Errorf("AttoFilToFil(nil) = %s, want 0", got)
+	}
+
+	ta, _ := big.FromString("1234567890123456789012")
+	if got := AttoFilToFil(ta).String(); got != "1234.567890123456789012" {
+		t.Errorf("AttoFilToFil = %s", got)
+	}
+}
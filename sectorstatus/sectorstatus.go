@@ -0,0 +1,174 @@
+package sectorstatus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+
+	"check-sector-info/sectorreport"
+)
+
+type PartitionAPI interface {
+	StateMinerDeadlines(context.Context, address.Address, types.TipSetKey) ([]api.Deadline, error)
+	StateMinerPartitions(context.Context, address.Address, uint64, types.TipSetKey) ([]api.Partition, error)
+}
+
+type API interface {
+	PartitionAPI
+	StateMinerFaults(context.Context, address.Address, types.TipSetKey) (bitfield.BitField, error)
+	StateMinerRecoveries(context.Context, address.Address, types.TipSetKey) (bitfield.BitField, error)
+	StateMinerSectors(context.Context, address.Address, *bitfield.BitField, types.TipSetKey) ([]*miner.SectorOnChainInfo, error)
+}
+
+// Partitions is the deadline and partition layout of a miner.
+type Partitions struct {
+	// PartitionCounts is the number of partitions of each deadline.
+	PartitionCounts []int
+	// AllSectors and LiveSectors merge the sets of every partition.
+	AllSectors  bitfield.BitField
+	LiveSectors bitfield.BitField
+
+	locations map[abi.SectorNumber]location
+}
+
+type location struct {
+	deadline, partition uint64
+}
+
+func (p *Partitions) Location(n abi.SectorNumber) (deadline, partition uint64, ok bool) {
+	loc, ok := p.locations[n]
+	return loc.deadline, loc.partition, ok
+}
+
+// LoadPartitions walks every partition of every deadline of the miner.
+func LoadPartitions(ctx context.Context, api PartitionAPI, maddr address.Address, tsk types.TipSetKey) (*Partitions, error) {
+	deadlines, err := api.StateMinerDeadlines(ctx, maddr, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get deadlines: %w", err)
+	}
+
+	p := &Partitions{
+		PartitionCounts: make([]int, len(deadlines)),
+		locations:       make(map[abi.SectorNumber]location),
+	}
+
+	var all, live []bitfield.BitField
+	for dlIdx := range deadlines {
+		partitions, err := api.StateMinerPartitions(ctx, maddr, uint64(dlIdx), tsk)
+		if err != nil {
+			return nil, fmt.Errorf("get partitions of deadline %d: %w", dlIdx, err)
+		}
+		p.PartitionCounts[dlIdx] = len(partitions)
+
+		for partIdx, part := range partitions {
+			all = append(all, part.AllSectors)
+			live = append(live, part.LiveSectors)
+
+			loc := location{deadline: uint64(dlIdx), partition: uint64(partIdx)}
+			err := part.AllSectors.ForEach(func(n uint64) error {
+				p.locations[abi.SectorNumber(n)] = loc
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("read sectors of deadline %d partition %d: %w", dlIdx, partIdx, err)
+			}
+		}
+	}
+
+	if p.AllSectors, err = bitfield.MultiMerge(all...); err != nil {
+		return nil, fmt.Errorf("merge partition sectors: %w", err)
+	}
+	if p.LiveSectors, err = bitfield.MultiMerge(live...); err != nil {
+		return nil, fmt.Errorf("merge live sectors: %w", err)
+	}
+	return p, nil
+}
+
+// Sectors are all sectors still listed in the miner's partitions, tagged
+// with their status.
+type Sectors struct {
+	*Partitions
+	Infos []*miner.SectorOnChainInfo
+
+	status map[abi.SectorNumber]sectorreport.Status
+}
+
+func (s *Sectors) Status(n abi.SectorNumber) sectorreport.Status {
+	return s.status[n]
+}
+
+// Live returns the sectors that still hold pledge, i.e. all but the
+// terminated ones.
+func (s *Sectors) Live() []*miner.SectorOnChainInfo {
+	live := make([]*miner.SectorOnChainInfo, 0, len(s.Infos))
+	for _, info := range s.Infos {
+		if s.status[info.SectorNumber] != sectorreport.Terminated {
+			live = append(live, info)
+		}
+	}
+	return live
+}
+
+// Load reads the live and terminated sets from the partition bitfields
+// and the faulty and recovering sets from StateMinerFaults and
+// StateMinerRecoveries. Terminated sectors whose info was already removed
+// from the miner state are not returned.
+func Load(ctx context.Context, api API, maddr address.Address, tsk types.TipSetKey) (*Sectors, error) {
+	p, err := LoadPartitions(ctx, api, maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	liveSet, err := toSet(p.LiveSectors, nil)
+	if err != nil {
+		return nil, fmt.Errorf("read live sectors: %w", err)
+	}
+	faultSet, err := toSet(api.StateMinerFaults(ctx, maddr, tsk))
+	if err != nil {
+		return nil, fmt.Errorf("get faults: %w", err)
+	}
+	recoverySet, err := toSet(api.StateMinerRecoveries(ctx, maddr, tsk))
+	if err != nil {
+		return nil, fmt.Errorf("get recoveries: %w", err)
+	}
+
+	infos, err := api.StateMinerSectors(ctx, maddr, &p.AllSectors, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get sectors: %w", err)
+	}
+
+	s := &Sectors{Partitions: p, Infos: infos}
+	s.status = make(map[abi.SectorNumber]sectorreport.Status, len(infos))
+	for _, info := range infos {
+		n := info.SectorNumber
+		switch {
+		case !liveSet[n]:
+			s.status[n] = sectorreport.Terminated
+		case recoverySet[n]:
+			s.status[n] = sectorreport.Recovering
+		case faultSet[n]:
+			s.status[n] = sectorreport.Faulty
+		default:
+			s.status[n] = sectorreport.Active
+		}
+	}
+	return s, nil
+}
+
+func toSet(bf bitfield.BitField, err error) (map[abi.SectorNumber]bool, error) {
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[abi.SectorNumber]bool)
+	err = bf.ForEach(func(n uint64) error {
+		set[abi.SectorNumber(n)] = true
+		return nil
+	})
+	return set, err
+}
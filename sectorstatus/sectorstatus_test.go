@@ -0,0 +1,78 @@
+package sectorstatus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+
+	"check-sector-info/lotustest"
+	"check-sector-info/sectorreport"
+)
+
+func TestLoad(t *testing.T) {
+	maddr, err := address.NewIDAddress(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sectors []*miner.SectorOnChainInfo
+	for n := abi.SectorNumber(1); n <= 5; n++ {
+		sectors = append(sectors, lotustest.Sector(n, 3000000, 4100000, lotustest.FIL(1)))
+	}
+	srv := lotustest.NewServer(t, &lotustest.Chain{
+		Head: 4000000,
+		Miners: map[address.Address]*lotustest.Miner{
+			maddr: {
+				Sectors:    sectors,
+				Faulty:     map[abi.SectorNumber]bool{2: true},
+				Recovering: map[abi.SectorNumber]bool{3: true},
+				Terminated: map[abi.SectorNumber]bool{4: true},
+				// sector 5 shares deadline 1 with sector 1 in a second partition
+				Locations: map[abi.SectorNumber][2]uint64{5: {1, 1}},
+			},
+		},
+	})
+	ctx := context.Background()
+	node, closer, err := client.NewFullNodeRPCV1(ctx, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+
+	s, err := Load(ctx, node, maddr, types.EmptyTSK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.PartitionCounts) != 48 || s.PartitionCounts[0] != 0 || s.PartitionCounts[1] != 2 || s.PartitionCounts[4] != 1 {
+		t.Errorf("partition counts %v", s.PartitionCounts)
+	}
+	var got []string
+	for _, info := range s.Infos {
+		dl, part, ok := s.Location(info.SectorNumber)
+		got = append(got, fmt.Sprintf("%d %s %d/%d %v", info.SectorNumber, s.Status(info.SectorNumber), dl, part, ok))
+	}
+	want := []string{
+		"1 active 1/0 true",
+		"2 faulty 2/0 true",
+		"3 recovering 3/0 true",
+		"4 terminated 4/0 true",
+		"5 active 1/1 true",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("sectors\n%q\nwant\n%q", got, want)
+	}
+	if live := s.Live(); len(live) != 4 {
+		t.Errorf("%d live sectors", len(live))
+	}
+	if _, _, ok := s.Location(9); ok {
+		t.Error("unknown sector located")
+	}
+	if s.Status(9) != "" || s.Status(1) != sectorreport.Active {
+		t.Errorf("status of 9 %q, of 1 %q", s.Status(9), s.Status(1))
+	}
+}
@@ -0,0 +1,39 @@
+package sqlexec
+
+import "testing"
+
+func TestParseDSN(t *testing.T) {
+	for _, c := range []struct {
+		dsn, driver string
+		dialect     Dialect
+		source      string
+	}{
+		{"root:pw@tcp(127.0.0.1:3306)/ops", "mysql", MySQL, "root:pw@tcp(127.0.0.1:3306)/ops"},
+		{"root:p://w@tcp(127.0.0.1:3306)/ops", "mysql", MySQL, "root:p://w@tcp(127.0.0.1:3306)/ops"},
+		{"mysql://root:pw@tcp(db)/ops?parseTime=true", "mysql", MySQL, "root:pw@tcp(db)/ops?parseTime=true"},
+		{"postgres://u:pw@db:5432/ops", "pgx", Postgres, "postgres://u:pw@db:5432/ops"},
+		{"postgresql://u@db/ops?sslmode=disable", "pgx", Postgres, "postgresql://u@db/ops?sslmode=disable"},
+		{"sqlite://ops.db", "sqlite", SQLite, "ops.db?_pragma=busy_timeout(5000)"},
+		{"sqlite:///var/lib/csi/ops.db?_pragma=foreign_keys(1)", "sqlite", SQLite, "/var/lib/csi/ops.db?_pragma=foreign_keys(1)"},
+	} {
+		driver, dialect, source, err := ParseDSN(c.dsn)
+		if err != nil || driver != c.driver || dialect != c.dialect || source != c.source {
+			t.Errorf("ParseDSN(%q) = %q, %q, %q, %v", c.dsn, driver, dialect, source, err)
+		}
+	}
+	for _, dsn := range []string{"sqlserver://db/ops", "sqlite://"} {
+		if _, _, _, err := ParseDSN(dsn); err == nil {
+			t.Errorf("ParseDSN(%q) accepted", dsn)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	q := "DELETE FROM t WHERE a = ? AND b = ?"
+	if got := MySQL.Rebind(q); got != q {
+		t.Errorf("mysql %s", got)
+	}
+	if got, want := Postgres.Rebind(q), "DELETE FROM t WHERE a = $1 AND b = $2"; got != want {
+		t.Errorf("postgres %s, want %s", got, want)
+	}
+}
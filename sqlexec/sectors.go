@@ -0,0 +1,117 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// SectorRow is one sector of a miner in filecoin_cluster_sector_snapshot.
+// Activation and Expiration are epochs, SectorKeyCID is empty for a sector
+// that was never updated.
+type SectorRow struct {
+	Name           string
+	Miner          string
+	UpdateDate     string
+	SectorNumber   uint64
+	Class          string
+	Activation     int64
+	Expiration     int64
+	ExpirationDate string
+	InitialPledge  decimal.Decimal
+	DealIDs        []uint64
+	SealProof      int64
+	SectorKeyCID   string
+}
+
+// ReplaceSectors is ReplaceExpirations for the per-sector snapshot.
+func (r *Repository) ReplaceSectors(ctx context.Context, miner, updateDate string, rows []SectorRow) error {
+	for _, row := range rows {
+		if row.Miner != miner || row.UpdateDate != updateDate {
+			return fmt.Errorf("sector %d of miner %s at %s in the snapshot of %s at %s", row.SectorNumber, row.Miner, row.UpdateDate, miner, updateDate)
+		}
+	}
+	return r.replace(ctx, deleteSectorsSQL, miner, updateDate, insertSectorsSQL, insertSectorSQL, len(rows), func(i int) []any {
+		row := rows[i]
+		return []any{row.Name, row.Miner, row.UpdateDate, int64(row.SectorNumber), row.Class,
+			row.Activation, row.Expiration, row.ExpirationDate, row.InitialPledge,
+			joinDealIDs(row.DealIDs), row.SealProof,
+			sql.NullString{String: row.SectorKeyCID, Valid: row.SectorKeyCID != ""}}
+	})
+}
+
+func (r *Repository) Sectors(ctx context.Context, miner, updateDate string) ([]SectorRow, error) {
+	stmt, err := r.prepared(ctx, selectSectorsSQL)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, miner, updateDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []SectorRow
+	for rows.Next() {
+		var row SectorRow
+		var number int64
+		var deals string
+		var key sql.NullString
+		update := timeText{layout: "2006-01-02 15:04:05", s: &row.UpdateDate}
+		expiration := timeText{layout: "2006-01-02", s: &row.ExpirationDate}
+		err := rows.Scan(&row.Name, &row.Miner, update, &number, &row.Class,
+			&row.Activation, &row.Expiration, expiration, &row.InitialPledge,
+			&deals, &row.SealProof, &key)
+		if err != nil {
+			return nil, err
+		}
+		row.SectorNumber = uint64(number)
+		row.SectorKeyCID = key.String
+		if row.DealIDs, err = splitDealIDs(deals); err != nil {
+			return nil, fmt.Errorf("sector %d: %w", number, err)
+		}
+		list = append(list, row)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) PruneSectors(ctx context.Context, before string) (int64, error) {
+	stmt, err := r.prepared(ctx, pruneSectorsSQL)
+	if err != nil {
+		return 0, err
+	}
+	res, err := stmt.ExecContext(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// joinDealIDs stores deal ids as "1,2,3", every backend has a text column.
+func joinDealIDs(ids []uint64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatUint(id, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+func splitDealIDs(s string) ([]uint64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	ids := make([]uint64, len(parts))
+	for i, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("deal ids %q: %w", s, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
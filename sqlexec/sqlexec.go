@@ -2,12 +2,17 @@ package sqlexec
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type Cluster struct {
@@ -15,11 +20,34 @@ type Cluster struct {
 	Miner string
 }
 
-func InitDB(DSN string) (DB *sql.DB, err error) {
+// ExpirationRow is one day of a miner's expiration schedule in
+// filecoin_cluster_sector_expiration.
+type ExpirationRow struct {
+	Name       string
+	Miner      string
+	Date       string
+	DCCount    int
+	DCPledge   decimal.Decimal
+	CCCount    int
+	CCPledge   decimal.Decimal
+	ODCount    int
+	ODPledge   decimal.Decimal
+	UpdateDate string
+}
+
+// Driver is the database/sql driver InitDB opens mysql DSNs with.
+var Driver = "mysql"
 
-	DB, err = sql.Open("mysql", DSN)
+// InitDB opens the DSN with the backend ParseDSN picks for it.
+func InitDB(DSN string) (DB *sql.DB, dialect Dialect, err error) {
+	driverName, dialect, source, err := ParseDSN(DSN)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	DB, err = sql.Open(driverName, source)
+	if err != nil {
+		return nil, "", err
 	}
 
 	info := fmt.Sprintf("dsn check success")
@@ -27,13 +55,14 @@ func InitDB(DSN string) (DB *sql.DB, err error) {
 
 	err = DB.Ping()
 	if err != nil {
-		return nil, err
+		DB.Close()
+		return nil, "", err
 	}
 
 	info = fmt.Sprintf("database connect success")
 	log.Println(info)
 
-	return DB, nil
+	return DB, dialect, nil
 }
 func ReadDSN() (dsn string, err error) {
 	file, err := os.Open("dsn")
@@ -62,39 +91,260 @@ func ReadDSN() (dsn string, err error) {
 	return lines[0], err
 }
 
-func Del(db *sql.DB, miner string, updateDate string) (sql string, err error) {
-	sql = fmt.Sprintf("delete from filecoin_cluster_sector_expiration where miner='%s' and update_date='%s'", miner, updateDate)
-	_, err = db.Exec(sql)
-	return sql, err
+const (
+	selectMinerSQL    = "SELECT f0 FROM cluster_list WHERE name = ?"
+	selectClustersSQL = "SELECT name, f0 FROM cluster_list"
+	selectRowsSQL     = "SELECT name, miner, date, dc_count, dc_pledge, cc_count, cc_pledge, od_count, od_pledge, update_date FROM filecoin_cluster_sector_expiration WHERE miner = ? AND update_date = ? ORDER BY date"
+	deleteSQL         = "DELETE FROM filecoin_cluster_sector_expiration WHERE miner = ? AND update_date = ?"
+	insertSQL         = "INSERT INTO filecoin_cluster_sector_expiration(name, miner, date, dc_count, dc_pledge, cc_count, cc_pledge, od_count, od_pledge, update_date) VALUES "
+	insertRowSQL      = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	selectSectorsSQL = "SELECT name, miner, update_date, sector_number, class, activation, expiration, expiration_date, initial_pledge, deal_ids, seal_proof, sector_key_cid FROM filecoin_cluster_sector_snapshot WHERE miner = ? AND update_date = ? ORDER BY sector_number"
+	deleteSectorsSQL = "DELETE FROM filecoin_cluster_sector_snapshot WHERE miner = ? AND update_date = ?"
+	insertSectorsSQL = "INSERT INTO filecoin_cluster_sector_snapshot(name, miner, update_date, sector_number, class, activation, expiration, expiration_date, initial_pledge, deal_ids, seal_proof, sector_key_cid) VALUES "
+	insertSectorSQL  = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	pruneSectorsSQL  = "DELETE FROM filecoin_cluster_sector_snapshot WHERE update_date < ?"
+)
+
+// InsertBatch is the most rows sent in one INSERT, up to 12 placeholders each
+// stay well below the 65535 mysql and postgres and the 32766 sqlite allow per
+// statement.
+var InsertBatch = 1000
+
+// ErrNoCluster is returned by Miner for a cluster not in cluster_list.
+var ErrNoCluster = errors.New("cluster not found")
+
+// Store is the ops database as the tools use it.
+type Store interface {
+	// Miner returns the miner of a cluster, ErrNoCluster if there is none.
+	Miner(ctx context.Context, cluster string) (string, error)
+	Clusters(ctx context.Context) ([]Cluster, error)
+	// ReplaceExpirations writes the snapshot of miner taken on updateDate.
+	ReplaceExpirations(ctx context.Context, miner, updateDate string, rows []ExpirationRow) error
+	// Expirations reads back a snapshot, ordered by date.
+	Expirations(ctx context.Context, miner, updateDate string) ([]ExpirationRow, error)
+	// ReplaceSectors writes the per-sector snapshot of miner taken on
+	// updateDate.
+	ReplaceSectors(ctx context.Context, miner, updateDate string, rows []SectorRow) error
+	// Sectors reads back a per-sector snapshot, ordered by sector number.
+	Sectors(ctx context.Context, miner, updateDate string) ([]SectorRow, error)
+	// PruneSectors deletes the per-sector snapshots taken before
+	// updateDate and returns the number of rows deleted.
+	PruneSectors(ctx context.Context, before string) (int64, error)
+	Close() error
+}
+
+var _ Store = (*Repository)(nil)
+
+// Repository is the Store of every dialect, their SQL only differs in the
+// placeholders. Every value is passed as a placeholder argument, never
+// spliced into SQL.
+type Repository struct {
+	db      *sql.DB
+	dialect Dialect
+
+	selectMiner    *sql.Stmt
+	selectClusters *sql.Stmt
+
+	// the statements on the snapshot tables are prepared on first use, a
+	// tool that only reads cluster_list also works before migrate up
+	lk    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// Open connects to dsn with InitDB and prepares the statements.
+func Open(ctx context.Context, dsn string) (*Repository, error) {
+	db, dialect, err := InitDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRepository(ctx, db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewRepository prepares the statements on db. Close closes db as well.
+func NewRepository(ctx context.Context, db *sql.DB, dialect Dialect) (*Repository, error) {
+	r := &Repository{db: db, dialect: dialect, stmts: map[string]*sql.Stmt{}}
+	for _, s := range []struct {
+		stmt **sql.Stmt
+		sql  string
+	}{
+		{&r.selectMiner, selectMinerSQL},
+		{&r.selectClusters, selectClustersSQL},
+	} {
+		stmt, err := db.PrepareContext(ctx, dialect.Rebind(s.sql))
+		if err != nil {
+			r.closeStmts()
+			return nil, fmt.Errorf("prepare %q: %w", s.sql, err)
+		}
+		*s.stmt = stmt
+	}
+	return r, nil
+}
+
+func (r *Repository) closeStmts() {
+	for _, stmt := range []*sql.Stmt{r.selectMiner, r.selectClusters} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	for _, stmt := range r.stmts {
+		stmt.Close()
+	}
+	r.stmts = map[string]*sql.Stmt{}
 }
 
-func Insert(db *sql.DB, name string, miner string, date string, DCCount int, DCPledge float64, CCCount int, CCPledge float64, updateDate string) (sql string, err error) {
-	sql = fmt.Sprintf("insert into filecoin_cluster_sector_expiration(name, miner, date, dc_count, dc_pledge, cc_count, cc_pledge,update_date) values('%s','%s','%s',%d,%.4f,%d,%.4f,'%s')",
-		name, miner, date, DCCount, DCPledge, CCCount, CCPledge, updateDate)
-	_, err = db.Exec(sql)
-	return sql, err
+// prepared returns the statement of query, preparing it the first time.
+func (r *Repository) prepared(ctx context.Context, query string) (*sql.Stmt, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if stmt, ok := r.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := r.db.PrepareContext(ctx, r.dialect.Rebind(query))
+	if err != nil {
+		return nil, fmt.Errorf("prepare %q: %w", query, err)
+	}
+	r.stmts[query] = stmt
+	return stmt, nil
 }
 
-func GetMiner(db *sql.DB, cluster string) (miner string, err error) {
-	SQL := fmt.Sprintf("SELECT f0 FROM cluster_list WHERE name='%s'", cluster)
-	err = db.QueryRow(SQL).Scan(&miner)
+func (r *Repository) Close() error {
+	r.closeStmts()
+	return r.db.Close()
+}
+
+// Miner returns the miner of a cluster, ErrNoCluster if there is none.
+func (r *Repository) Miner(ctx context.Context, cluster string) (string, error) {
+	var miner string
+	err := r.selectMiner.QueryRowContext(ctx, cluster).Scan(&miner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %q", ErrNoCluster, cluster)
+	}
 	return miner, err
 }
 
-func GetCluster(db *sql.DB) (clusterList []Cluster, err error) {
-	GetSQL := "SELECT name,f0 FROM cluster_list"
-	rows, err := db.Query(GetSQL)
+func (r *Repository) Clusters(ctx context.Context) ([]Cluster, error) {
+	rows, err := r.selectClusters.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var c Cluster
+	defer rows.Close()
+
+	var clusters []Cluster
 	for rows.Next() {
-		err = rows.Scan(&c.Name, &c.Miner)
+		var c Cluster
+		if err := rows.Scan(&c.Name, &c.Miner); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, rows.Err()
+}
+
+// ReplaceExpirations replaces the rows of miner written on updateDate with
+// rows in one transaction, so that a snapshot is either complete or left as
+// it was, and writing the same snapshot again changes nothing.
+func (r *Repository) ReplaceExpirations(ctx context.Context, miner, updateDate string, rows []ExpirationRow) error {
+	for _, row := range rows {
+		if row.Miner != miner || row.UpdateDate != updateDate {
+			return fmt.Errorf("row %s of miner %s at %s in the snapshot of %s at %s", row.Date, row.Miner, row.UpdateDate, miner, updateDate)
+		}
+	}
+	return r.replace(ctx, deleteSQL, miner, updateDate, insertSQL, insertRowSQL, len(rows), func(i int) []any {
+		row := rows[i]
+		return []any{row.Name, row.Miner, row.Date,
+			row.DCCount, row.DCPledge, row.CCCount, row.CCPledge,
+			row.ODCount, row.ODPledge, row.UpdateDate}
+	})
+}
+
+// replace runs del for miner and updateDate and inserts n rows with the
+// values of row, in batches of InsertBatch, in one transaction.
+func (r *Repository) replace(ctx context.Context, del, miner, updateDate, insert, rowSQL string, n int, row func(i int) []any) (err error) {
+	delStmt, err := r.prepared(ctx, del)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
 		if err != nil {
-			fmt.Println(err)
-			continue
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.StmtContext(ctx, delStmt).ExecContext(ctx, miner, updateDate); err != nil {
+		return fmt.Errorf("delete rows of %s: %w", updateDate, err)
+	}
+	for start := 0; start < n; start += InsertBatch {
+		end := min(start+InsertBatch, n)
+		values := make([]string, 0, end-start)
+		var args []any
+		for i := start; i < end; i++ {
+			values = append(values, rowSQL)
+			args = append(args, row(i)...)
+		}
+		query := r.dialect.Rebind(insert + strings.Join(values, ", "))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("insert rows %d-%d: %w", start, end-1, err)
 		}
-		clusterList = append(clusterList, c)
 	}
-	return clusterList, nil
-}
\ No newline at end of file
+	return tx.Commit()
+}
+
+func (r *Repository) Expirations(ctx context.Context, miner, updateDate string) ([]ExpirationRow, error) {
+	stmt, err := r.prepared(ctx, selectRowsSQL)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, miner, updateDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []ExpirationRow
+	for rows.Next() {
+		var row ExpirationRow
+		date := timeText{layout: "2006-01-02", s: &row.Date}
+		update := timeText{layout: "2006-01-02 15:04:05", s: &row.UpdateDate}
+		err := rows.Scan(&row.Name, &row.Miner, date, &row.DCCount, &row.DCPledge,
+			&row.CCCount, &row.CCPledge, &row.ODCount, &row.ODPledge, update)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, row)
+	}
+	return list, rows.Err()
+}
+
+// timeText scans a date or datetime column into the text it was written
+// as, whether the driver returns it as text or as time.Time.
+type timeText struct {
+	layout string
+	s      *string
+}
+
+func (t timeText) Scan(v any) error {
+	switch v := v.(type) {
+	case time.Time:
+		*t.s = v.Format(t.layout)
+	case []byte:
+		*t.s = string(v)
+	case string:
+		*t.s = v
+	default:
+		return fmt.Errorf("scan %T as a date", v)
+	}
+	return nil
+}
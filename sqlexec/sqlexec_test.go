@@ -0,0 +1,195 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"check-sector-info/lotustest"
+)
+
+var hostile = []string{
+	"xc64' OR '1'='1",
+	"x'; DROP TABLE cluster_list; -- ",
+	`back\'slash`,
+	"名字\x00nul",
+	"",
+}
+
+func testRepository(t *testing.T, clusters []lotustest.Cluster) (*Repository, string) {
+	dsn := lotustest.NewDB(t, clusters)
+	db, err := sql.Open(lotustest.DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRepository(context.Background(), db, MySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, dsn
+}
+
+func TestMinerHostileNames(t *testing.T) {
+	clusters := []lotustest.Cluster{{Name: "xc64", Miner: "f01234"}}
+	for i, name := range hostile {
+		clusters = append(clusters, lotustest.Cluster{Name: name, Miner: fmt.Sprintf("f0100%d", i)})
+	}
+	r, dsn := testRepository(t, clusters)
+	ctx := context.Background()
+
+	for i, name := range hostile {
+		m, err := r.Miner(ctx, name)
+		if err != nil || m != clusters[i+1].Miner {
+			t.Errorf("Miner(%q) = %q, %v, want %q", name, m, err, clusters[i+1].Miner)
+		}
+	}
+	if _, err := r.Miner(ctx, "hk01' OR ''='"); !errors.Is(err, ErrNoCluster) {
+		t.Errorf("unknown cluster: err = %v", err)
+	}
+
+	for i, s := range lotustest.Statements(t, dsn) {
+		if s.Query != selectMinerSQL || len(s.Args) != 1 {
+			t.Errorf("statement %d = %+v", i, s)
+		}
+		if i < len(hostile) && s.Args[0] != hostile[i] {
+			t.Errorf("statement %d argument %q, want %q", i, s.Args[0], hostile[i])
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	want := []lotustest.Cluster{{Name: "xc64", Miner: "f01234"}, {Name: hostile[0], Miner: "f05678"}}
+	r, _ := testRepository(t, want)
+	got, err := r.Clusters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("clusters = %+v", got)
+	}
+	for i := range got {
+		if got[i].Name != want[i].Name || got[i].Miner != want[i].Miner {
+			t.Errorf("cluster %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func snapshot(name, miner string, days int) []ExpirationRow {
+	rows := make([]ExpirationRow, days)
+	for i := range rows {
+		rows[i] = ExpirationRow{
+			Name:       name,
+			Miner:      miner,
+			Date:       fmt.Sprintf("2027-01-%02d", i+1),
+			DCCount:    1,
+			DCPledge:   decimal.RequireFromString("1.5"),
+			CCCount:    2,
+			CCPledge:   decimal.Zero,
+			ODCount:    3,
+			ODPledge:   decimal.Zero,
+			UpdateDate: "2026-10-18 00:00:00",
+		}
+	}
+	return rows
+}
+
+func TestReplaceHostileNames(t *testing.T) {
+	r, dsn := testRepository(t, nil)
+	ctx := context.Background()
+
+	for _, name := range hostile {
+		if err := r.ReplaceExpirations(ctx, name, "2026-10-18 00:00:00", snapshot(name, name, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stmts := lotustest.Statements(t, dsn)
+	if len(stmts) != 4*len(hostile) {
+		t.Fatalf("%d statements, want %d", len(stmts), 4*len(hostile))
+	}
+	for i, name := range hostile {
+		del, ins := stmts[4*i+1], stmts[4*i+2]
+		if del.Query != deleteSQL || del.Args[0] != name {
+			t.Errorf("delete of %q = %+v", name, del)
+		}
+		if ins.Query != insertSQL+insertRowSQL || ins.Args[0] != name || ins.Args[1] != name || ins.Args[4] != "1.5" {
+			t.Errorf("insert of %q = %+v", name, ins)
+		}
+	}
+}
+
+func queries(stmts []lotustest.Statement) []string {
+	var qs []string
+	for _, s := range stmts {
+		q, _, _ := strings.Cut(s.Query, " ")
+		qs = append(qs, fmt.Sprintf("%s/%d", q, len(s.Args)))
+	}
+	return qs
+}
+
+func TestReplaceBatches(t *testing.T) {
+	defer func(n int) { InsertBatch = n }(InsertBatch)
+	InsertBatch = 2
+
+	r, dsn := testRepository(t, nil)
+	if err := r.ReplaceExpirations(context.Background(), "f01234", "2026-10-18 00:00:00", snapshot("xc64", "f01234", 5)); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(queries(lotustest.Statements(t, dsn)), " ")
+	if want := "BEGIN/0 DELETE/2 INSERT/20 INSERT/20 INSERT/10 COMMIT/0"; got != want {
+		t.Errorf("statements %s, want %s", got, want)
+	}
+}
+
+func TestReplaceRollsBack(t *testing.T) {
+	r, dsn := testRepository(t, nil)
+	ctx := context.Background()
+	lotustest.FailOn(t, dsn, "INSERT")
+
+	if err := r.ReplaceExpirations(ctx, "f01234", "2026-10-18 00:00:00", snapshot("xc64", "f01234", 3)); err == nil {
+		t.Fatal("failed insert not reported")
+	}
+	// rows of another miner are refused before anything is written
+	if err := r.ReplaceExpirations(ctx, "f01234", "2026-10-18 00:00:00", snapshot("xc64", "f05678", 1)); err == nil {
+		t.Fatal("foreign row accepted")
+	}
+
+	got := strings.Join(queries(lotustest.Statements(t, dsn)), " ")
+	if want := "BEGIN/0 DELETE/2 INSERT/30 ROLLBACK/0"; got != want {
+		t.Errorf("statements %s, want %s", got, want)
+	}
+}
+
+func TestReplaceSectors(t *testing.T) {
+	defer func(n int) { InsertBatch = n }(InsertBatch)
+	InsertBatch = 2
+
+	r, dsn := testRepository(t, nil)
+	rows := make([]SectorRow, 3)
+	for i := range rows {
+		rows[i] = SectorRow{Name: "xc64", Miner: "f01234", UpdateDate: "2026-10-18 00:00:00", SectorNumber: uint64(i),
+			Class: "dc", InitialPledge: decimal.RequireFromString("0.5"), DealIDs: []uint64{7, 11}}
+	}
+	rows[2].DealIDs, rows[2].SectorKeyCID = nil, "bafkqaaa"
+	if err := r.ReplaceSectors(context.Background(), "f01234", "2026-10-18 00:00:00", rows); err != nil {
+		t.Fatal(err)
+	}
+
+	stmts := lotustest.Statements(t, dsn)
+	if got, want := strings.Join(queries(stmts), " "), "BEGIN/0 DELETE/2 INSERT/24 INSERT/12 COMMIT/0"; got != want {
+		t.Fatalf("statements %s, want %s", got, want)
+	}
+	first, last := stmts[2].Args, stmts[3].Args
+	if first[9] != "7,11" || first[11] != nil || last[9] != "" || last[11] != "bafkqaaa" {
+		t.Errorf("deal ids and sector keys %v %v", first, last)
+	}
+	if ids, err := splitDealIDs("7,11"); err != nil || fmt.Sprint(ids) != "[7 11]" {
+		t.Errorf("splitDealIDs = %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,57 @@
+package termination
+
+import (
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	miner16 "github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+)
+
+// Parameters of the termination fee before FIP-0098 (network version 25).
+const (
+	legacyLifetimeCap             = abi.ChainEpoch(140) * builtin.EpochsInDay
+	legacyLowerBoundProjection    = (builtin.EpochsInDay * 35) / 10
+	legacyRewardFactorNumerator   = 1
+	legacyRewardFactorDenominator = 2
+)
+
+// Estimate returns the penalty for terminating s at epoch. The network's
+// smoothed reward and power estimates are not known here, so the fault fee
+// based lower bounds are projected from the sector's ExpectedDayReward.
+func Estimate(s *miner.SectorOnChainInfo, nv network.Version, epoch abi.ChainEpoch) abi.TokenAmount {
+	dayReward := orZero(s.ExpectedDayReward)
+	age := max(epoch-s.PowerBaseEpoch, 0)
+
+	if nv >= network.Version25 {
+		faultFee := projectDayReward(dayReward, miner16.ContinuedFaultProjectionPeriod)
+		return miner16.PledgePenaltyForTermination(orZero(&s.InitialPledge), age, faultFee)
+	}
+
+	// max(BR(3.5d), BR(StartEpoch, 20d) + BR(StartEpoch, 1d) * 1/2 * min(age + replaced age, 140d))
+	cappedAge := min(age, legacyLifetimeCap)
+	expectedReward := big.Mul(dayReward, big.NewInt(int64(cappedAge)))
+
+	replacedAge := min(max(s.PowerBaseEpoch-s.Activation, 0), legacyLifetimeCap-cappedAge)
+	expectedReward = big.Add(expectedReward, big.Mul(orZero(s.ReplacedDayReward), big.NewInt(int64(replacedAge))))
+
+	penalizedReward := big.Div(
+		big.Mul(expectedReward, big.NewInt(legacyRewardFactorNumerator)),
+		big.NewInt(builtin.EpochsInDay*legacyRewardFactorDenominator))
+
+	return big.Max(
+		projectDayReward(dayReward, legacyLowerBoundProjection),
+		big.Add(orZero(s.ExpectedStoragePledge), penalizedReward))
+}
+
+func projectDayReward(dayReward abi.TokenAmount, period abi.ChainEpoch) abi.TokenAmount {
+	return big.Div(big.Mul(dayReward, big.NewInt(int64(period))), big.NewInt(builtin.EpochsInDay))
+}
+
+func orZero(ta *abi.TokenAmount) abi.TokenAmount {
+	if ta == nil || ta.Int == nil {
+		return big.Zero()
+	}
+	return *ta
+}
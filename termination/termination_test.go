@@ -0,0 +1,85 @@
+package termination
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+)
+
+const day = builtin.EpochsInDay
+
+func atto(s string) abi.TokenAmount {
+	v, err := big.FromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// The expected fees are worked out by hand from the formulas, amounts are
+// in attoFIL and every sector pledges 1 FIL.
+func TestEstimate(t *testing.T) {
+	const powerBase = abi.ChainEpoch(1_000_000)
+	for _, c := range []struct {
+		name           string
+		nv             network.Version
+		age            abi.ChainEpoch
+		replacedAge    abi.ChainEpoch
+		dayReward      string
+		replacedReward string
+		storagePledge  string
+		want           string
+	}{
+		// FIP-0098: max(min(8.5% pledge, 8.5% pledge * age/140d), 2% pledge, 1.05 * 3.51d of reward)
+		{name: "nv25 capped age", nv: network.Version25, age: 200 * day, dayReward: "1000000000000000",
+			want: "85000000000000000"},
+		{name: "nv25 age below cap", nv: network.Version25, age: 70 * day, dayReward: "1000000000000000",
+			want: "42500000000000000"},
+		{name: "nv25 min pledge share", nv: network.Version25, age: 10 * day, dayReward: "1000000000000000",
+			want: "20000000000000000"},
+		// 1e17 * 10108 / 2880 * 105 / 100
+		{name: "nv25 fault fee", nv: network.Version25, age: 200 * day, dayReward: "100000000000000000",
+			want: "368520833333333333"},
+		{name: "nv25 before power base", nv: network.Version25, age: -day, dayReward: "1000000000000000",
+			want: "20000000000000000"},
+
+		// max(3.5d of reward, storage pledge + reward * min(age + replaced age, 140d) / 2)
+		{name: "legacy", nv: network.Version24, age: 100 * day, dayReward: "1000000000000000", storagePledge: "20000000000000000",
+			want: "70000000000000000"},
+		{name: "legacy capped age", nv: network.Version24, age: 200 * day, dayReward: "1000000000000000", storagePledge: "20000000000000000",
+			want: "90000000000000000"},
+		// 2e16 + (1e15 * 100d + 2e15 * 40d) / 2
+		{name: "legacy replaced sector", nv: network.Version24, age: 100 * day, replacedAge: 100 * day,
+			dayReward: "1000000000000000", replacedReward: "2000000000000000", storagePledge: "20000000000000000",
+			want: "110000000000000000"},
+		{name: "legacy lower bound", nv: network.Version24, age: day, dayReward: "1000000000000000",
+			want: "3500000000000000"},
+		{name: "legacy no rewards", nv: network.Version24, age: 100 * day,
+			want: "0"},
+	} {
+		s := &miner.SectorOnChainInfo{
+			Activation:     powerBase - c.replacedAge,
+			PowerBaseEpoch: powerBase,
+			InitialPledge:  atto("1000000000000000000"),
+		}
+		if c.dayReward != "" {
+			r := atto(c.dayReward)
+			s.ExpectedDayReward = &r
+		}
+		if c.replacedReward != "" {
+			r := atto(c.replacedReward)
+			s.ReplacedDayReward = &r
+		}
+		if c.storagePledge != "" {
+			p := atto(c.storagePledge)
+			s.ExpectedStoragePledge = &p
+		}
+		if got := Estimate(s, c.nv, powerBase+c.age); !got.Equals(atto(c.want)) {
+			t.Errorf("%s: fee %s, want %s", c.name, got, c.want)
+		}
+	}
+}
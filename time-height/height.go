@@ -1,35 +1,171 @@
 package timeToHeight
 
 import (
-	"github.com/filecoin-project/go-state-types/abi"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
 )
 
+const dateTimeFormat = "2006-01-02 15:04:05"
+
+// Network is what epoch/time conversion needs to know about a chain.
+type Network struct {
+	Name       string
+	Genesis    time.Time
+	BlockDelay time.Duration
+}
+
+var (
+	Mainnet  = Network{Name: "mainnet", Genesis: time.Unix(1598306400, 0), BlockDelay: 30 * time.Second}
+	Calibnet = Network{Name: "calibrationnet", Genesis: time.Unix(1667326380, 0), BlockDelay: 30 * time.Second}
+)
+
+// ParseNetwork accepts mainnet, calibnet (or calibrationnet) and
+// devnet:<genesis unix seconds>[:<block delay seconds>] for custom networks.
+func ParseNetwork(s string) (Network, error) {
+	switch s {
+	case "mainnet":
+		return Mainnet, nil
+	case "calibnet", "calibrationnet":
+		return Calibnet, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if parts[0] != "devnet" || len(parts) < 2 || len(parts) > 3 {
+		return Network{}, fmt.Errorf("unknown network %q, must be mainnet, calibnet or devnet:<genesis>[:<block delay>]", s)
+	}
+	genesis, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Network{}, fmt.Errorf("bad devnet genesis timestamp %q: %w", parts[1], err)
+	}
+	n := Network{Name: "devnet", Genesis: time.Unix(genesis, 0), BlockDelay: 30 * time.Second}
+	if len(parts) == 3 {
+		delay, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil || delay == 0 {
+			return Network{}, fmt.Errorf("bad devnet block delay %q", parts[2])
+		}
+		n.BlockDelay = time.Duration(delay) * time.Second
+	}
+	return n, nil
+}
+
+type NetworkAPI interface {
+	StateGetNetworkParams(context.Context) (*api.NetworkParams, error)
+}
+
+// DetectNetwork asks the node which network it follows. Unknown networks take
+// their genesis and block delay from the node's parameters.
+func DetectNetwork(ctx context.Context, node NetworkAPI) (Network, error) {
+	params, err := node.StateGetNetworkParams(ctx)
+	if err != nil {
+		return Network{}, err
+	}
+	switch string(params.NetworkName) {
+	case Mainnet.Name:
+		return Mainnet, nil
+	case Calibnet.Name:
+		return Calibnet, nil
+	}
+	return Network{
+		Name:       string(params.NetworkName),
+		Genesis:    time.Unix(int64(params.GenesisTimestamp), 0),
+		BlockDelay: time.Duration(params.BlockDelaySecs) * time.Second,
+	}, nil
+}
+
+// Converter converts between epochs and wall clock time of one network.
+// Times are returned in, and dates without a zone parsed in, Location.
+type Converter struct {
+	Network  Network
+	Location *time.Location
+}
+
+func NewConverter(n Network, loc *time.Location) Converter {
+	if loc == nil {
+		loc = time.Local
+	}
+	return Converter{Network: n, Location: loc}
+}
+
+func (c Converter) HeightToTime(height abi.ChainEpoch) time.Time {
+	return c.Network.Genesis.Add(time.Duration(height) * c.Network.BlockDelay).In(c.Location)
+}
+
+func (c Converter) HeightToDay(height abi.ChainEpoch) string {
+	return c.HeightToTime(height).Format("2006-01-02")
+}
+
+// TimeToHeight returns the last epoch starting at or before t.
+func (c Converter) TimeToHeight(t time.Time) abi.ChainEpoch {
+	d := t.Sub(c.Network.Genesis)
+	h := d / c.Network.BlockDelay
+	if d < 0 && d%c.Network.BlockDelay != 0 {
+		h--
+	}
+	return abi.ChainEpoch(h)
+}
+
+// ParseTime parses "2006-01-02 15:04:05" in the converter's location.
+func (c Converter) ParseTime(s string) (time.Time, error) {
+	return time.ParseInLocation(dateTimeFormat, s, c.Location)
+}
+
+// Default backs the package level helpers. It is mainnet in the local zone
+// until SetDefault is called.
+var Default = NewConverter(Mainnet, time.Local)
+
+func SetDefault(c Converter) {
+	Default = c
+}
+
+// LoadLocation is time.LoadLocation, with "" meaning the machine's zone.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
 func HeightToTime(height abi.ChainEpoch) time.Time {
-	subHeight := height - 1851120
-	loc, _ := time.LoadLocation("Local")
-	CriterionTime, _ := time.ParseInLocation("2006-01-02 15:04:05", "2022-05-30 00:00:00", loc)
-	h, _ := time.ParseDuration("0.5m")
-	return CriterionTime.Add(time.Duration(subHeight) * h)
+	return Default.HeightToTime(height)
 }
 
 func HeightToDay(height abi.ChainEpoch) string {
-	subHeight := height - 1851120
-	loc, _ := time.LoadLocation("Local")
-	CriterionTime, _ := time.ParseInLocation("2006-01-02 15:04:05", "2022-05-30 00:00:00", loc)
-	h, _ := time.ParseDuration("0.5m")
-	return CriterionTime.Add(time.Duration(subHeight) * h).Format("2006-01-02")
+	return Default.HeightToDay(height)
 }
 
 func StrToTime(dateStr string) (parsedTime time.Time, err error) {
-	dateTimeFormat := "2006-01-02 15:04:05"
-	parsedTime, err = time.Parse(dateTimeFormat, dateStr)
-	return parsedTime, err
+	return Default.ParseTime(dateStr)
 }
 
 func TimeToHeight(t time.Time) abi.ChainEpoch {
-	loc, _ := time.LoadLocation("Local")
-	CriterionTime, _ := time.ParseInLocation("2006-01-02 15:04:05", "2022-05-30 00:00:00", loc)
-	subSecond := t.Sub(CriterionTime)
-	return abi.ChainEpoch(subSecond.Seconds()/30 + float64(1851120))
+	return Default.TimeToHeight(t)
+}
+
+// Configure sets Default from the -network and -tz flags of the tools. An
+// empty network is detected from the node.
+func Configure(ctx context.Context, node NetworkAPI, network, tz string) (Converter, error) {
+	loc, err := LoadLocation(tz)
+	if err != nil {
+		return Converter{}, err
+	}
+
+	var n Network
+	if network != "" {
+		n, err = ParseNetwork(network)
+	} else {
+		n, err = DetectNetwork(ctx, node)
+	}
+	if err != nil {
+		return Converter{}, err
+	}
+
+	c := NewConverter(n, loc)
+	SetDefault(c)
+	return c, nil
 }
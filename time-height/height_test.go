@@ -0,0 +1,115 @@
+package timeToHeight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+)
+
+func TestMainnetAnchor(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	c := NewConverter(Mainnet, shanghai)
+
+	// the anchor the tools used before the converter was network aware
+	want := time.Date(2022, 5, 30, 0, 0, 0, 0, shanghai)
+	if got := c.HeightToTime(1851120); !got.Equal(want) {
+		t.Errorf("HeightToTime(1851120) = %s, want %s", got, want)
+	}
+	if got := c.HeightToDay(1851120); got != "2022-05-30" {
+		t.Errorf("HeightToDay(1851120) = %s", got)
+	}
+
+	parsed, err := c.ParseTime("2022-05-30 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := c.TimeToHeight(parsed); h != 1851120 {
+		t.Errorf("TimeToHeight = %d, want 1851120", h)
+	}
+
+	utc := NewConverter(Mainnet, time.UTC)
+	parsed, err = utc.ParseTime("2022-05-29 16:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := utc.TimeToHeight(parsed); h != 1851120 {
+		t.Errorf("utc TimeToHeight = %d, want 1851120", h)
+	}
+	if got := utc.HeightToDay(1851120); got != "2022-05-29" {
+		t.Errorf("utc HeightToDay(1851120) = %s", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	devnet, err := ParseNetwork("devnet:1700000000:4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []Network{Mainnet, Calibnet, devnet} {
+		for _, loc := range []*time.Location{time.UTC, time.FixedZone("UTC+8", 8*3600), time.FixedZone("UTC-5", -5*3600)} {
+			c := NewConverter(n, loc)
+			for _, h := range []abi.ChainEpoch{-3, 0, 1, 1851120, 4_500_000} {
+				tm := c.HeightToTime(h)
+				if tm.Location() != loc {
+					t.Errorf("%s: HeightToTime returned zone %s, want %s", n.Name, tm.Location(), loc)
+				}
+				if got := c.TimeToHeight(tm); got != h {
+					t.Errorf("%s %s: TimeToHeight(HeightToTime(%d)) = %d", n.Name, loc, h, got)
+				}
+				// anywhere inside the epoch maps back to it
+				if got := c.TimeToHeight(tm.Add(n.BlockDelay - time.Second)); got != h {
+					t.Errorf("%s %s: end of epoch %d maps to %d", n.Name, loc, h, got)
+				}
+
+				parsed, err := c.ParseTime(tm.Format(dateTimeFormat))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !parsed.Equal(tm) {
+					t.Errorf("%s %s: ParseTime(%s) = %s", n.Name, loc, tm.Format(dateTimeFormat), parsed)
+				}
+			}
+		}
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	for _, s := range []string{"mainnet", "calibnet", "calibrationnet", "devnet:1700000000", "devnet:1700000000:6"} {
+		if _, err := ParseNetwork(s); err != nil {
+			t.Errorf("%s: %s", s, err)
+		}
+	}
+	for _, s := range []string{"", "butterfly", "devnet", "devnet:x", "devnet:1:0", "devnet:1:2:3"} {
+		if _, err := ParseNetwork(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+type fakeNode api.NetworkParams
+
+func (f fakeNode) StateGetNetworkParams(context.Context) (*api.NetworkParams, error) {
+	p := api.NetworkParams(f)
+	return &p, nil
+}
+
+func TestDetectNetwork(t *testing.T) {
+	n, err := DetectNetwork(context.Background(), fakeNode{NetworkName: "calibrationnet"})
+	if err != nil || n != Calibnet {
+		t.Errorf("calibrationnet detected as %+v, %v", n, err)
+	}
+
+	n, err = DetectNetwork(context.Background(), fakeNode{NetworkName: "localnet-1", GenesisTimestamp: 1700000000, BlockDelaySecs: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Name != "localnet-1" || n.Genesis.Unix() != 1700000000 || n.BlockDelay != 4*time.Second {
+		t.Errorf("devnet detected as %+v", n)
+	}
+}
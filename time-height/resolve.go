@@ -0,0 +1,123 @@
+package timeToHeight
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type ChainAPI interface {
+	ChainHead(context.Context) (*types.TipSet, error)
+	ChainGetTipSetByHeight(context.Context, abi.ChainEpoch, types.TipSetKey) (*types.TipSet, error)
+}
+
+// Resolution is the tipset a wall clock time was resolved to.
+type Resolution struct {
+	Requested time.Time       `json:"requested"`
+	Estimate  abi.ChainEpoch  `json:"estimate"`
+	Height    abi.ChainEpoch  `json:"height"`
+	Tipset    types.TipSetKey `json:"tipset"`
+	Timestamp time.Time       `json:"timestamp"`
+	// EpochOffset is Estimate - Height, DriftSeconds is Requested - Timestamp.
+	EpochOffset  abi.ChainEpoch `json:"epoch_offset"`
+	DriftSeconds int64          `json:"drift_seconds"`
+	Exact        bool           `json:"exact"`
+}
+
+func (r Resolution) String() string {
+	return fmt.Sprintf("height %d (estimate %d, offset %d epochs), tipset time %s (%s before requested), tipset %s",
+		r.Height, r.Estimate, r.EpochOffset, r.Timestamp.Format(dateTimeFormat), time.Duration(r.DriftSeconds)*time.Second, r.Tipset)
+}
+
+func (c Converter) resolution(t time.Time, ts *types.TipSet) Resolution {
+	stamp := time.Unix(int64(ts.MinTimestamp()), 0).In(c.Location)
+	estimate := c.TimeToHeight(t)
+	return Resolution{
+		Requested:    t,
+		Estimate:     estimate,
+		Height:       ts.Height(),
+		Tipset:       ts.Key(),
+		Timestamp:    stamp,
+		EpochOffset:  estimate - ts.Height(),
+		DriftSeconds: t.Unix() - stamp.Unix(),
+	}
+}
+
+// Lookup takes the tipset at the estimated height the way lotus does, a null
+// round yields the tipset before it.
+func (c Converter) Lookup(ctx context.Context, node ChainAPI, t time.Time) (Resolution, error) {
+	ts, err := node.ChainGetTipSetByHeight(ctx, c.TimeToHeight(t), types.EmptyTSK)
+	if err != nil {
+		return Resolution{}, err
+	}
+	return c.resolution(t, ts), nil
+}
+
+// Resolve binary searches the chain for the last tipset whose timestamp is not
+// after t, so neither null rounds nor epochs that drifted from the nominal
+// block delay make it pick the wrong state.
+func (c Converter) Resolve(ctx context.Context, node ChainAPI, t time.Time) (Resolution, error) {
+	head, err := node.ChainHead(ctx)
+	if err != nil {
+		return Resolution{}, err
+	}
+	if t.Unix() >= int64(head.MinTimestamp()) {
+		r := c.resolution(t, head)
+		r.Exact = true
+		return r, nil
+	}
+
+	at := func(h abi.ChainEpoch) (*types.TipSet, error) {
+		return node.ChainGetTipSetByHeight(ctx, h, head.Key())
+	}
+
+	lo, hi := abi.ChainEpoch(0), head.Height()
+	best, err := at(lo)
+	if err != nil {
+		return Resolution{}, err
+	}
+	if t.Unix() < int64(best.MinTimestamp()) {
+		return Resolution{}, fmt.Errorf("%s is before genesis", t.Format(dateTimeFormat))
+	}
+
+	// invariant: the tipset at lo is not after t, the one at hi is
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ts, err := at(mid)
+		if err != nil {
+			return Resolution{}, err
+		}
+		if int64(ts.MinTimestamp()) <= t.Unix() {
+			lo, best = mid, ts
+		} else {
+			hi = mid
+		}
+	}
+
+	r := c.resolution(t, best)
+	r.Exact = true
+	return r, nil
+}
+
+func Lookup(ctx context.Context, node ChainAPI, t time.Time) (Resolution, error) {
+	return Default.Lookup(ctx, node, t)
+}
+
+func Resolve(ctx context.Context, node ChainAPI, t time.Time) (Resolution, error) {
+	return Default.Resolve(ctx, node, t)
+}
+
+// At describes a tipset that was picked directly, e.g. the head or a tipset
+// key given by the user.
+func (c Converter) At(ts *types.TipSet) Resolution {
+	r := c.resolution(time.Unix(int64(ts.MinTimestamp()), 0).In(c.Location), ts)
+	r.Exact = true
+	return r
+}
+
+func At(ts *types.TipSet) Resolution {
+	return Default.At(ts)
+}
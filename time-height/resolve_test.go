@@ -0,0 +1,127 @@
+package timeToHeight
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+)
+
+var dummyCid, _ = cid.Parse("bafkqaaa")
+
+// fakeChain is a chain whose tipsets at the null heights are missing.
+type fakeChain struct {
+	net     Network
+	head    abi.ChainEpoch
+	null    map[abi.ChainEpoch]bool
+	lateBy  time.Duration
+	lookups int
+}
+
+func (f *fakeChain) tipset(h abi.ChainEpoch) *types.TipSet {
+	miner, _ := address.NewIDAddress(1000)
+	ts, err := types.NewTipSet([]*types.BlockHeader{{
+		Miner:                 miner,
+		Ticket:                &types.Ticket{VRFProof: []byte{byte(h)}},
+		ElectionProof:         &types.ElectionProof{},
+		Height:                h,
+		Parents:               []cid.Cid{dummyCid},
+		ParentWeight:          big.Zero(),
+		ParentStateRoot:       dummyCid,
+		ParentMessageReceipts: dummyCid,
+		Messages:              dummyCid,
+		ParentBaseFee:         big.Zero(),
+		Timestamp:             uint64(f.net.Genesis.Add(time.Duration(h)*f.net.BlockDelay + f.lateBy).Unix()),
+	}})
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
+
+func (f *fakeChain) ChainHead(context.Context) (*types.TipSet, error) {
+	return f.tipset(f.head), nil
+}
+
+func (f *fakeChain) ChainGetTipSetByHeight(_ context.Context, h abi.ChainEpoch, _ types.TipSetKey) (*types.TipSet, error) {
+	f.lookups++
+	if h > f.head {
+		return nil, fmt.Errorf("height %d is in the future", h)
+	}
+	for h > 0 && f.null[h] {
+		h--
+	}
+	return f.tipset(h), nil
+}
+
+func TestResolveNullRounds(t *testing.T) {
+	c := NewConverter(Mainnet, time.UTC)
+	chain := &fakeChain{net: Mainnet, head: 5_000_000, null: map[abi.ChainEpoch]bool{4_000_000: true, 4_000_001: true}}
+
+	requested := c.HeightToTime(4_000_001).Add(10 * time.Second)
+
+	looked, err := c.Lookup(context.Background(), chain, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if looked.Height != 3_999_999 || looked.Estimate != 4_000_001 || looked.EpochOffset != 2 {
+		t.Errorf("lookup = %+v", looked)
+	}
+
+	r, err := c.Resolve(context.Background(), chain, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Exact || r.Height != 3_999_999 || r.EpochOffset != 2 || r.DriftSeconds != 70 {
+		t.Errorf("resolve = %+v", r)
+	}
+	if chain.lookups > 30 {
+		t.Errorf("%d lookups, want a binary search", chain.lookups)
+	}
+
+	// after the null rounds the tipset at the requested height is used
+	r, err = c.Resolve(context.Background(), chain, c.HeightToTime(4_000_002))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Height != 4_000_002 || r.EpochOffset != 0 || r.DriftSeconds != 0 {
+		t.Errorf("resolve = %+v", r)
+	}
+}
+
+func TestResolveDriftedTimestamps(t *testing.T) {
+	c := NewConverter(Mainnet, time.UTC)
+	// every block is 45s late, the estimate is one epoch ahead of the chain
+	chain := &fakeChain{net: Mainnet, head: 5_000_000, lateBy: 45 * time.Second}
+
+	r, err := c.Resolve(context.Background(), chain, c.HeightToTime(4_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Height != 3_999_998 || r.EpochOffset != 2 || r.DriftSeconds != 15 {
+		t.Errorf("resolve = %+v", r)
+	}
+}
+
+func TestResolveBounds(t *testing.T) {
+	c := NewConverter(Mainnet, time.UTC)
+	chain := &fakeChain{net: Mainnet, head: 1000}
+
+	r, err := c.Resolve(context.Background(), chain, c.HeightToTime(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Height != 1000 || r.EpochOffset != 1000 {
+		t.Errorf("future time resolved to %+v, want the head", r)
+	}
+
+	if _, err := c.Resolve(context.Background(), chain, Mainnet.Genesis.Add(-time.Hour)); err == nil {
+		t.Error("expected an error before genesis")
+	}
+}